@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// maxBatchOperations is the largest number of operations a batch may hold.
+const maxBatchOperations = 100
+
+// batchMethods and batchHeaders list what an operation of a batch may use.
+var (
+	batchMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	batchHeaders = []string{"Content-Type", "If-Match", "If-None-Match"}
+)
+
+var (
+	// batchRefRX matches the names operations are given so that later operations can refer to their results.
+	batchRefRX = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	// batchPlaceholderRX matches a reference to a value in the response body of an earlier operation, such as
+	// "{movie.movie.id}", whose first part is the name of the operation.
+	batchPlaceholderRX = regexp.MustCompile(`\{([A-Za-z][A-Za-z0-9_]*)((?:\.[A-Za-z0-9_]+)+)\}`)
+)
+
+// errBatchFailed is returned from the transaction of a batch to roll it back when one of its operations fails.
+var errBatchFailed = errors.New("an operation of the batch failed")
+
+// batchOperation is a request to one of the movie routes, made as part of a batch.
+type batchOperation struct {
+	Ref     string            `json:"ref"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// batchResult is the response to an operation of a batch.
+type batchResult struct {
+	Ref     string            `json:"ref,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// batchHandler runs a list of operations against the movie routes, in order and in a single transaction. Each
+// operation is checked against the permissions of the user as if it had been sent on its own. When every operation
+// succeeds, their results are returned; otherwise the transaction is rolled back and the batch is answered with the
+// status of the operation which failed, along with the results up to it.
+func (app *application) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Operations []batchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if validateBatch(v, input.Operations); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results := []batchResult{}
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		// The operations are served by the movie routes of an application whose models are bound to the
+		// transaction. None of those routes start background tasks, so the application doesn't need the wait group.
+		batch := &application{config: app.config, logger: app.logger, models: tx, mailer: app.mailer, blobs: app.blobs}
+
+		router := httprouter.New()
+		router.NotFound = http.HandlerFunc(batch.notFoundResponse)
+		router.MethodNotAllowed = http.HandlerFunc(batch.methodNotAllowedResponse)
+		batch.movieRoutes(router, nil)
+
+		bodies := map[string]interface{}{}
+
+		for i, op := range input.Operations {
+			result, err := batch.runBatchOperation(router, r, i, op, bodies)
+			if err != nil {
+				return err
+			}
+
+			results = append(results, result)
+
+			if result.Status >= http.StatusBadRequest {
+				return errBatchFailed
+			}
+
+			if op.Ref != "" {
+				dec := json.NewDecoder(bytes.NewReader(result.Body))
+				dec.UseNumber()
+
+				var body interface{}
+				if dec.Decode(&body) == nil {
+					bodies[op.Ref] = body
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if errors.Is(err, errBatchFailed) {
+		failed := results[len(results)-1]
+		message := fmt.Sprintf("operation %d failed, so none of the operations were applied", len(results)-1)
+
+		err = app.writeResponse(w, r, failed.Status, envelope{"error": message, "results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateBatch checks the operations of a batch before any of them is run. References may only name operations
+// which come earlier in the batch.
+func validateBatch(v *validator.Validator, operations []batchOperation) {
+	v.Check(len(operations) > 0, "operations", "must contain at least one operation")
+	v.Check(len(operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+
+	refs := map[string]bool{}
+
+	for i, op := range operations {
+		key := fmt.Sprintf("operations[%d]", i)
+
+		v.Check(validator.In(op.Method, batchMethods...), key+".method", "must be one of "+strings.Join(batchMethods, ", "))
+		v.Check(op.Path == "/v1/movies" || strings.HasPrefix(op.Path, "/v1/movies/") || strings.HasPrefix(op.Path, "/v1/movies?"), key+".path", "must be a path under /v1/movies")
+
+		for header := range op.Headers {
+			v.Check(validator.In(http.CanonicalHeaderKey(header), batchHeaders...), key+".headers", fmt.Sprintf("must not contain %s", header))
+		}
+
+		for _, m := range batchPlaceholderRX.FindAllStringSubmatch(op.Path+string(op.Body), -1) {
+			v.Check(refs[m[1]], key, fmt.Sprintf("refers to %s, which isn't the ref of an earlier operation", m[1]))
+		}
+
+		if op.Ref != "" {
+			v.Check(batchRefRX.MatchString(op.Ref), key+".ref", "must start with a letter and contain only letters, digits and underscores")
+			v.Check(!refs[op.Ref], key+".ref", "must be unique")
+			refs[op.Ref] = true
+		}
+	}
+}
+
+// runBatchOperation fills the references in an operation from the response bodies of earlier operations, and sends
+// it to the router on behalf of the user of the batch. Responses are written as compact JSON, whatever the format of
+// the batch response, so that they can be embedded in it.
+func (app *application) runBatchOperation(router http.Handler, r *http.Request, i int, op batchOperation, bodies map[string]interface{}) (batchResult, error) {
+	result := batchResult{Ref: op.Ref}
+
+	path, err := resolveBatchPath(op.Path, bodies)
+	if err == nil {
+		op.Body, err = resolveBatchBody(op.Body, bodies)
+	}
+	if err != nil {
+		return app.batchErrorResult(result, http.StatusUnprocessableEntity, envelope{fmt.Sprintf("operations[%d]", i): err.Error()})
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), op.Method, path, bytes.NewReader(op.Body))
+	if err != nil {
+		return app.batchErrorResult(result, http.StatusUnprocessableEntity, envelope{fmt.Sprintf("operations[%d].path", i): "must be a valid path"})
+	}
+
+	req.RemoteAddr = r.RemoteAddr
+	for header, value := range op.Headers {
+		req.Header.Set(header, value)
+	}
+	if len(op.Body) > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	req = app.contextSetEncoder(req, compactJSONEncoder)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	result.Status = rec.Code
+	result.Body = bytes.TrimSpace(rec.Body.Bytes())
+
+	for _, header := range []string{"Location", "ETag"} {
+		if value := rec.Header().Get(header); value != "" {
+			if result.Headers == nil {
+				result.Headers = map[string]string{}
+			}
+			result.Headers[header] = value
+		}
+	}
+
+	return result, nil
+}
+
+// batchErrorResult completes the result of an operation which couldn't be sent, with an error body like those of
+// failedValidationResponse().
+func (app *application) batchErrorResult(result batchResult, status int, fields envelope) (batchResult, error) {
+	body, err := json.Marshal(envelope{"error": fields})
+	if err != nil {
+		return result, err
+	}
+
+	result.Status = status
+	result.Body = body
+
+	return result, nil
+}
+
+// resolveBatchPath replaces the references in the path of an operation with the values they refer to.
+func resolveBatchPath(path string, bodies map[string]interface{}) (string, error) {
+	return replaceBatchPlaceholders(path, bodies, url.PathEscape)
+}
+
+// resolveBatchBody replaces the references in the string values of the body of an operation. A string which is
+// nothing but a reference is replaced with the value it refers to, keeping its JSON type, e.g. to pass the id of a
+// new movie as a number.
+func resolveBatchBody(body json.RawMessage, bodies map[string]interface{}) (json.RawMessage, error) {
+	if len(body) == 0 || !batchPlaceholderRX.Match(body) {
+		return body, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var doc interface{}
+	err := dec.Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err = resolveBatchValue(doc, bodies)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(doc)
+}
+
+func resolveBatchValue(value interface{}, bodies map[string]interface{}) (interface{}, error) {
+	var err error
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			value[k], err = resolveBatchValue(v, bodies)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i], err = resolveBatchValue(v, bodies)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case string:
+		if m := batchPlaceholderRX.FindStringSubmatch(value); m != nil && m[0] == value {
+			return lookupBatchReference(m, bodies)
+		}
+		return replaceBatchPlaceholders(value, bodies, func(s string) string { return s })
+	}
+
+	return value, nil
+}
+
+// replaceBatchPlaceholders replaces each reference in s with the text of the value it refers to, passed through
+// escape.
+func replaceBatchPlaceholders(s string, bodies map[string]interface{}, escape func(string) string) (string, error) {
+	var err error
+
+	s = batchPlaceholderRX.ReplaceAllStringFunc(s, func(placeholder string) string {
+		value, lookupErr := lookupBatchReference(batchPlaceholderRX.FindStringSubmatch(placeholder), bodies)
+		if lookupErr != nil {
+			err = lookupErr
+			return placeholder
+		}
+
+		switch value := value.(type) {
+		case string:
+			return escape(value)
+		case json.Number:
+			return value.String()
+		}
+
+		js, _ := json.Marshal(value)
+		return escape(string(js))
+	})
+
+	return s, err
+}
+
+// lookupBatchReference follows the dotted path of a reference, matched by batchPlaceholderRX, into the response body
+// of the operation it names. Array elements are referred to by index.
+func lookupBatchReference(m []string, bodies map[string]interface{}) (interface{}, error) {
+	value := bodies[m[1]]
+
+	for _, key := range strings.Split(m[2][1:], ".") {
+		switch container := value.(type) {
+		case map[string]interface{}:
+			member, ok := container[key]
+			if !ok {
+				return nil, fmt.Errorf("refers to %s, which is not in the response of %s", m[0], m[1])
+			}
+			value = member
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(container) {
+				return nil, fmt.Errorf("refers to %s, which is not in the response of %s", m[0], m[1])
+			}
+			value = container[i]
+		default:
+			return nil, fmt.Errorf("refers to %s, which is not in the response of %s", m[0], m[1])
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// batchResults returns the status of each result of a batch response and its decoded body.
+func batchResults(t *testing.T, js map[string]interface{}) ([]int, []map[string]interface{}) {
+	t.Helper()
+
+	statuses := []int{}
+	bodies := []map[string]interface{}{}
+
+	results, _ := js["results"].([]interface{})
+	for _, result := range results {
+		result := result.(map[string]interface{})
+		statuses = append(statuses, int(result["status"].(float64)))
+
+		body, _ := result["body"].(map[string]interface{})
+		bodies = append(bodies, body)
+	}
+
+	return statuses, bodies
+}
+
+func TestBatchPlaceholders(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	batch := `{"operations": [
+		{"ref": "moana", "method": "POST", "path": "/v1/movies", "body": ` + testMovie + `},
+		{"method": "PATCH", "path": "/v1/movies/{moana.movie.id}", "body": {"title": "{moana.movie.title} 2", "year": 2024}},
+		{"ref": "sequel", "method": "GET", "path": "/v1/movies/{moana.movie.id}"},
+		{"method": "PUT", "path": "/v1/movies/{moana.movie.id}/credits", "body": {"credits": []}},
+		{"method": "GET", "path": "/v1/movies?title={sequel.movie.title}"}
+	]}`
+
+	status, _, js := ts.do(http.MethodPost, "/v1/batch", token, batch)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusOK, js)
+	}
+
+	statuses, bodies := batchResults(t, js)
+
+	want := []int{http.StatusCreated, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("got statuses %v; want %v", statuses, want)
+	}
+
+	// A placeholder within a string is replaced with the text of the value.
+	if title := bodies[2]["movie"].(map[string]interface{})["title"]; title != "Moana 2" {
+		t.Errorf("got title %v; want %q", title, "Moana 2")
+	}
+
+	// Placeholders in the path are escaped.
+	if movies := bodies[4]["movies"].([]interface{}); len(movies) != 1 {
+		t.Errorf("got %d movies searching for the title; want 1", len(movies))
+	}
+}
+
+func TestBatchPlaceholderTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"Whole string", `{"id": "{a.movie.id}"}`, `{"id":1}`},
+		{"Within a string", `{"id": "movie {a.movie.id}"}`, `{"id":"movie 1"}`},
+		{"Nested", `{"ids": ["{a.movie.id}", {"title": "{a.movie.genres.1}"}]}`, `{"ids":[1,{"title":"adventure"}]}`},
+		{"Whole object", `{"genres": "{a.movie.genres}"}`, `{"genres":["animation","adventure"]}`},
+	}
+
+	var created interface{}
+	err := json.Unmarshal([]byte(`{"movie": {"id": 1, "genres": ["animation", "adventure"]}}`), &created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies := map[string]interface{}{"a": created}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveBatchBody(json.RawMessage(tt.body), bodies)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("got body %s; want %s", got, tt.want)
+			}
+		})
+	}
+
+	_, err = resolveBatchBody(json.RawMessage(`{"id": "{a.movie.year}"}`), bodies)
+	if err == nil {
+		t.Error("got no error for a reference to a missing member")
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+	reader := ts.newUser("bob@example.com", true, "movies:read")
+
+	tests := []struct {
+		name         string
+		token        string
+		batch        string
+		wantStatus   int
+		wantStatuses []int
+	}{
+		{
+			"Invalid operation",
+			token,
+			`{"operations": [
+				{"ref": "moana", "method": "POST", "path": "/v1/movies", "body": ` + testMovie + `},
+				{"method": "PATCH", "path": "/v1/movies/{moana.movie.id}", "body": {"title": ""}},
+				{"method": "DELETE", "path": "/v1/movies/{moana.movie.id}"}
+			]}`,
+			http.StatusUnprocessableEntity,
+			[]int{http.StatusCreated, http.StatusUnprocessableEntity},
+		},
+		{
+			"Missing member",
+			token,
+			`{"operations": [
+				{"ref": "moana", "method": "POST", "path": "/v1/movies", "body": ` + testMovie + `},
+				{"method": "GET", "path": "/v1/movies/{moana.movie.rating}"}
+			]}`,
+			http.StatusUnprocessableEntity,
+			[]int{http.StatusCreated, http.StatusUnprocessableEntity},
+		},
+		{
+			"Missing permission",
+			reader,
+			`{"operations": [
+				{"method": "GET", "path": "/v1/movies"},
+				{"method": "POST", "path": "/v1/movies", "body": ` + testMovie + `}
+			]}`,
+			http.StatusForbidden,
+			[]int{http.StatusOK, http.StatusForbidden},
+		},
+		{
+			"Missing movie",
+			token,
+			`{"operations": [
+				{"method": "POST", "path": "/v1/movies", "body": ` + testMovie + `},
+				{"method": "DELETE", "path": "/v1/movies/100"}
+			]}`,
+			http.StatusNotFound,
+			[]int{http.StatusCreated, http.StatusNotFound},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(http.MethodPost, "/v1/batch", tt.token, tt.batch)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			// The results stop at the operation which failed.
+			statuses, _ := batchResults(t, js)
+			if !reflect.DeepEqual(statuses, tt.wantStatuses) {
+				t.Errorf("got statuses %v; want %v", statuses, tt.wantStatuses)
+			}
+
+			if stored := ts.countMovies(); stored != 0 {
+				t.Errorf("got %d movies stored; want 0", stored)
+			}
+		})
+	}
+}
+
+func TestBatchValidation(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	tests := []struct {
+		name      string
+		batch     string
+		wantField string
+	}{
+		{"No operations", `{"operations": []}`, "operations"},
+		{"Other route", `{"operations": [{"method": "GET", "path": "/v1/users/me/ratings"}]}`, "operations[0].path"},
+		{"Unknown method", `{"operations": [{"method": "HEAD", "path": "/v1/movies"}]}`, "operations[0].method"},
+		{"Header", `{"operations": [{"method": "GET", "path": "/v1/movies", "headers": {"Authorization": "Bearer x"}}]}`, "operations[0].headers"},
+		{"Later ref", `{"operations": [{"method": "GET", "path": "/v1/movies/{b.movie.id}"}, {"ref": "b", "method": "GET", "path": "/v1/movies"}]}`, "operations[0]"},
+		{"Repeated ref", `{"operations": [{"ref": "a", "method": "GET", "path": "/v1/movies"}, {"ref": "a", "method": "GET", "path": "/v1/movies"}]}`, "operations[1].ref"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(http.MethodPost, "/v1/batch", token, tt.batch)
+			if status != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d: %v", status, http.StatusUnprocessableEntity, js)
+			}
+
+			if errs, _ := js["error"].(map[string]interface{}); errs[tt.wantField] == nil {
+				t.Errorf("got error %v; want one for %s", js["error"], tt.wantField)
+			}
+		})
+	}
+}
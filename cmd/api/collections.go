@@ -0,0 +1,297 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// errCollectionRejected aborts the transaction of a collection whose movies failed checkCollectionMovies().
+var errCollectionRejected = errors.New("collection rejected")
+
+// checkCollectionMovies reports in v the first movie of the collection which doesn't exist or is in the trash,
+// looking them all up in a single query. Movies which were already in the collection are let through, so that a movie
+// moved to the trash can keep its place. It must be given the movies of the transaction the collection is saved in,
+// which keeps the movies it finds from being moved to the trash before the transaction commits.
+func checkCollectionMovies(v *validator.Validator, movies data.MovieStore, collection *data.Collection, previous []int64) error {
+	kept := make(map[int64]bool, len(previous))
+	for _, id := range previous {
+		kept[id] = true
+	}
+
+	added := []int64{}
+	for _, id := range collection.MovieIDs {
+		if !kept[id] {
+			added = append(added, id)
+		}
+	}
+
+	if len(added) == 0 {
+		return nil
+	}
+
+	missing, err := movies.Missing(added)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		v.AddError("movie_ids", fmt.Sprintf("must only contain existing movies (%d is not one)", missing[0]))
+		return errCollectionRejected
+	}
+
+	return nil
+}
+
+// saveCollectionError sends the response for an error from the transaction which saves a collection.
+func (app *application) saveCollectionError(w http.ResponseWriter, r *http.Request, v *validator.Validator, err error) {
+	switch {
+	case errors.Is(err, errCollectionRejected):
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrMissingCollectionMovie):
+		// A movie was purged between the check and the insert.
+		v.AddError("movie_ids", "must only contain existing movies")
+		app.failedValidationResponse(w, r, v.Errors)
+	case errors.Is(err, data.ErrEditConflict):
+		app.ErrEditConflictResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCollectionsHandler lists the collections, optionally only those whose name contains the name parameter.
+func (app *application) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	collections, metadata, err := app.models.Collections.GetAll(input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"collections": collections, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createCollectionHandler adds a collection. The movies are listed by id in the collection's order.
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string  `json:"name"`
+		Description string  `json:"description"`
+		MovieIDs    []int64 `json:"movie_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := &data.Collection{
+		Name:        input.Name,
+		Description: input.Description,
+		MovieIDs:    input.MovieIDs,
+	}
+
+	if collection.MovieIDs == nil {
+		collection.MovieIDs = []int64{}
+	}
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		err := checkCollectionMovies(v, tx.Movies, collection, nil)
+		if err != nil {
+			return err
+		}
+
+		return tx.Collections.Insert(collection)
+	})
+	if err != nil {
+		app.saveCollectionError(w, r, v, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/collections/%d", collection.ID))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"collection": collection}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCollectionHandler changes the name or description of a collection, or replaces its movies as a whole, which
+// is how they are reordered.
+func (app *application) updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	collection, err := app.models.Collections.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		MovieIDs    []int64 `json:"movie_ids"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	previous := collection.MovieIDs
+
+	if input.Name != nil {
+		collection.Name = *input.Name
+	}
+
+	if input.Description != nil {
+		collection.Description = *input.Description
+	}
+
+	if input.MovieIDs != nil {
+		collection.MovieIDs = input.MovieIDs
+	}
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		err := checkCollectionMovies(v, tx.Movies, collection, previous)
+		if err != nil {
+			return err
+		}
+
+		return tx.Collections.Update(collection)
+	})
+	if err != nil {
+		app.saveCollectionError(w, r, v, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"collection": collection}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Collections.Delete(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "collection successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getMovieCollectionsHandler lists the collections a movie belongs to.
+func (app *application) getMovieCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.movieNotFoundResponse(w, r, id)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	collections, err := app.models.Collections.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"collections": collections}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
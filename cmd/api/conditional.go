@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/lorezi/duxfilm/internal/data"
+)
+
+// movieETag returns the strong entity tag of a movie as the request asks for it, "<id>-<version>-<digest>". Every edit
+// of a movie increments its version, so the id and version together identify one state of its editable fields. The
+// digest covers what else the bytes of the response depend on: the rating aggregates and images, which change
+// without the version, and the representation chosen by movieVariant().
+func (app *application) movieETag(r *http.Request, movie *data.Movie, shape movieShape) string {
+	h := sha256.New()
+
+	writeMovieState(h, movie)
+	io.WriteString(h, app.movieVariant(r, shape))
+
+	return fmt.Sprintf(`"%s-%x"`, movieVersionTag(movie), h.Sum(nil)[:8])
+}
+
+// movieVersionTag returns the part of a movie's entity tag which If-Match preconditions are checked against. The rest
+// of the tag is left out, so that ratings, image uploads and the representation a client chose never make an edit
+// fail its precondition.
+func movieVersionTag(movie *data.Movie) string {
+	return fmt.Sprintf("%d-%d", movie.ID, movie.Version)
+}
+
+// moviesETag returns a weak entity tag for a page of movies. It is derived from the id, version, rating aggregates
+// and images of each movie along with the pagination metadata and the representation chosen by movieVariant(), so it
+// changes whenever any movie on the page changes, the page moves or another representation is asked for.
+func (app *application) moviesETag(r *http.Request, movies []*data.Movie, metadata data.Metadata, shape movieShape) string {
+	h := sha256.New()
+
+	for _, movie := range movies {
+		writeMovieState(h, movie)
+		h.Write([]byte{','})
+	}
+	fmt.Fprintf(h, "%+v", metadata)
+	io.WriteString(h, app.movieVariant(r, shape))
+
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16])
+}
+
+// writeMovieState writes the id, version, rating aggregates and image keys of a movie to h.
+func writeMovieState(h io.Writer, movie *data.Movie) {
+	fmt.Fprintf(h, "%d-%d-%d-%g", movie.ID, movie.Version, movie.RatingCount, movie.RatingAverage)
+	for _, kind := range data.ImageKinds {
+		if image := movie.Images[kind]; image != nil {
+			fmt.Fprintf(h, "-%s", image.Key)
+		}
+	}
+}
+
+// movieVariant identifies the representation of movies a request asks for: the negotiated format, the duration
+// format, the languages of the titles and the selected fields.
+func (app *application) movieVariant(r *http.Request, shape movieShape) string {
+	languages := []string{}
+	for _, tag := range app.contextGetLanguages(r) {
+		languages = append(languages, tag.String())
+	}
+
+	return fmt.Sprintf("%s;%s;%s;%s", app.contextGetEncoder(r).format, app.contextGetDurationFormat(r),
+		strings.Join(languages, ","), strings.Join(shape.Fields, ","))
+}
+
+// etagMatches reports whether an If-None-Match header value lists the entity tag. It uses the weak comparison, which
+// ignores the W/ prefix.
+func etagMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified sets the ETag header and, if the request's If-None-Match header matches it, sends a 304 Not Modified
+// response. It returns true when the response has been sent.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatches(header, etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// preconditionMet reports whether the request's If-Match header, if any, lists an entity tag of the movie's current
+// version, whichever representation it was issued for.
+func (app *application) preconditionMet(r *http.Request, movie *data.Movie) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	version := movieVersionTag(movie)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.Trim(strings.TrimSpace(tag), `"`)
+
+		if tag == version || strings.HasPrefix(tag, version+"-") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// editConflictResponse reports that the record changed while a request was being processed. Requests which made the
+// change conditional with If-Match get a 412 Precondition Failed response, as the condition no longer holds.
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("If-Match") != "" {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	app.ErrEditConflictResponse(w, r)
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
 
 	"github.com/lorezi/duxfilm/internal/data"
+	"golang.org/x/text/language"
 )
 
 // Define a custom contextKey type, with the underlying type string.
@@ -32,3 +34,65 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+const durationFormatContextKey = contextKey("durationFormat")
+
+// contextSetDurationFormat returns a copy of the request carrying the format durations are written in.
+func (app *application) contextSetDurationFormat(r *http.Request, format data.DurationFormat) *http.Request {
+	ctx := context.WithValue(r.Context(), durationFormatContextKey, format)
+	return r.WithContext(ctx)
+}
+
+// contextGetDurationFormat returns the format durations are written in, which is the zero format unless one was
+// requested.
+func (app *application) contextGetDurationFormat(r *http.Request) data.DurationFormat {
+	format, _ := r.Context().Value(durationFormatContextKey).(data.DurationFormat)
+	return format
+}
+
+const languagesContextKey = contextKey("languages")
+
+// contextSetLanguages returns a copy of the request carrying the languages movie titles are written in.
+func (app *application) contextSetLanguages(r *http.Request, languages []language.Tag) *http.Request {
+	ctx := context.WithValue(r.Context(), languagesContextKey, languages)
+	return r.WithContext(ctx)
+}
+
+// contextGetLanguages returns the languages movie titles are written in, most preferred first. It is empty unless
+// some were requested, leaving the titles in their original language.
+func (app *application) contextGetLanguages(r *http.Request) []language.Tag {
+	languages, _ := r.Context().Value(languagesContextKey).([]language.Tag)
+	return languages
+}
+
+const encoderContextKey = contextKey("encoder")
+
+// contextSetEncoder returns a copy of the request carrying the encoder negotiated for its response.
+func (app *application) contextSetEncoder(r *http.Request, enc *encoder) *http.Request {
+	ctx := context.WithValue(r.Context(), encoderContextKey, enc)
+	return r.WithContext(ctx)
+}
+
+// contextGetEncoder returns the encoder negotiated for the response to the request. Responses sent before the
+// negotiation, or instead of it, are written as indented JSON.
+func (app *application) contextGetEncoder(r *http.Request) *encoder {
+	enc, ok := r.Context().Value(encoderContextKey).(*encoder)
+	if !ok {
+		return jsonEncoder
+	}
+	return enc
+}
+
+const connContextKey = contextKey("conn")
+
+// contextSetConn returns a copy of the context of a connection carrying the connection itself. It is set as the
+// server's ConnContext, so that handlers can change the deadlines of the connection their request arrived on.
+func (app *application) contextSetConn(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey, c)
+}
+
+// contextGetConn returns the connection the request arrived on, if it came through serve().
+func (app *application) contextGetConn(r *http.Request) (net.Conn, bool) {
+	c, ok := r.Context().Value(connContextKey).(net.Conn)
+	return c, ok
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// errNotList is returned by encoders which can only write lists, when the data isn't one.
+var errNotList = errors.New("the data isn't a list")
+
+// encoder writes response envelopes in one format. Apart from JSON, the data is first turned into its JSON form, so
+// that every format has the same field names and values.
+type encoder struct {
+	// format is the value of the format query string parameter which selects the encoder.
+	format      string
+	contentType string
+	encode      func(data envelope) ([]byte, error)
+}
+
+var (
+	jsonEncoder = &encoder{format: "json", contentType: "application/json", encode: func(data envelope) ([]byte, error) {
+		js, err := json.MarshalIndent(data, "", "\t")
+		return append(js, '\n'), err
+	}}
+	compactJSONEncoder = &encoder{format: "json-compact", contentType: "application/json", encode: func(data envelope) ([]byte, error) {
+		js, err := json.Marshal(data)
+		return append(js, '\n'), err
+	}}
+	xmlEncoder     = &encoder{format: "xml", contentType: "application/xml; charset=utf-8", encode: encodeXML}
+	csvEncoder     = &encoder{format: "csv", contentType: "text/csv; charset=utf-8", encode: encodeCSV}
+	msgpackEncoder = &encoder{format: "msgpack", contentType: "application/msgpack", encode: encodeMsgpack}
+)
+
+var encoders = []*encoder{jsonEncoder, compactJSONEncoder, xmlEncoder, csvEncoder, msgpackEncoder}
+
+// encoderForMediaType returns the encoder for a media type of an Accept header, or nil if none writes it. JSON is
+// indented unless the pretty parameter is false, e.g. "application/json; pretty=false".
+func encoderForMediaType(mediaType string, params map[string]string) *encoder {
+	switch mediaType {
+	case "*/*", "application/*", "application/json":
+		if params["pretty"] == "false" {
+			return compactJSONEncoder
+		}
+		return jsonEncoder
+	case "application/xml", "text/xml":
+		return xmlEncoder
+	case "text/csv":
+		return csvEncoder
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return msgpackEncoder
+	}
+
+	return nil
+}
+
+// negotiateEncoder chooses the encoder named by the format query string parameter or, if it is empty, the supported
+// media type of the Accept header with the highest quality. It returns nil when nothing requested can be written.
+func negotiateEncoder(format, accept string) *encoder {
+	if format != "" {
+		for _, enc := range encoders {
+			if enc.format == format {
+				return enc
+			}
+		}
+		return nil
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return jsonEncoder
+	}
+
+	type mediaRange struct {
+		enc     *encoder
+		quality float64
+	}
+
+	ranges := []mediaRange{}
+	for _, s := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(s)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		enc := encoderForMediaType(mediaType, params)
+		if enc != nil && quality > 0 {
+			ranges = append(ranges, mediaRange{enc: enc, quality: quality})
+		}
+	}
+
+	// Media ranges of equal quality are preferred in the order they are listed.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	return ranges[0].enc
+}
+
+// jsonMember is a member of a jsonObject.
+type jsonMember struct {
+	Key   string
+	Value interface{}
+}
+
+// jsonObject is a JSON object whose members are written in order, unlike a map whose keys are sorted.
+type jsonObject []jsonMember
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(member.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(member.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// jsonTree returns the JSON form of the data as a tree of jsonObject, []interface{}, string, json.Number, bool and
+// nil values. Objects keep the order of their members.
+func jsonTree(data interface{}) (interface{}, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	return decodeJSONTree(dec)
+}
+
+func decodeJSONTree(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := jsonObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeJSONTree(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			object = append(object, jsonMember{Key: key.(string), Value: value})
+		}
+
+		// read the closing brace
+		_, err = dec.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for dec.More() {
+			value, err := decodeJSONTree(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			array = append(array, value)
+		}
+
+		// read the closing bracket
+		_, err = dec.Token()
+		return array, err
+	}
+
+	return token, nil
+}
+
+// xmlNameRX matches the keys which can be used as XML element names as they are.
+var xmlNameRX = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// encodeXML writes the data inside a <response> element. Object members become elements named after their keys,
+// or <entry key="..."> elements when the key isn't a valid name, and the values of arrays become <item> elements.
+func encodeXML(data envelope) ([]byte, error) {
+	tree, err := jsonTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+
+	err = writeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	err = enc.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(enc *xml.Encoder, start xml.StartElement, value interface{}) error {
+	err := enc.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case jsonObject:
+		for _, member := range value {
+			child := xml.StartElement{Name: xml.Name{Local: member.Key}}
+			if !xmlNameRX.MatchString(member.Key) || strings.HasPrefix(strings.ToLower(member.Key), "xml") {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "entry"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: member.Key}},
+				}
+			}
+
+			err = writeXMLElement(enc, child, member.Value)
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			err = writeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item)
+			if err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		err = enc.EncodeToken(xml.CharData(fmt.Sprint(value)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// encodeCSV writes the single list of the data, such as the movies of a page, with a column for each field of the
+// listed objects. Anything else in the data, such as the pagination metadata, is left out. An error is written as a
+// list of the fields in error, or as a single message.
+func encodeCSV(data envelope) ([]byte, error) {
+	tree, err := jsonTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []interface{}
+	lists := 0
+
+	for _, member := range tree.(jsonObject) {
+		switch value := member.Value.(type) {
+		case []interface{}:
+			rows = value
+			lists++
+		case jsonObject:
+			if member.Key == "error" {
+				for _, field := range value {
+					rows = append(rows, jsonObject{{Key: "field", Value: field.Key}, {Key: "error", Value: field.Value}})
+				}
+				lists++
+			}
+		case string:
+			if member.Key == "error" {
+				rows = []interface{}{jsonObject{{Key: "error", Value: value}}}
+				lists++
+			}
+		}
+	}
+
+	if lists != 1 {
+		return nil, errNotList
+	}
+
+	// Every field found in any row gets a column, in the order the fields are first seen.
+	columns := []string{}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		object, ok := row.(jsonObject)
+		if !ok {
+			object = jsonObject{{Key: "value"}}
+		}
+
+		for _, member := range object {
+			if !seen[member.Key] {
+				seen[member.Key] = true
+				columns = append(columns, member.Key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	err = w.Write(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		object, ok := row.(jsonObject)
+		if !ok {
+			object = jsonObject{{Key: "value", Value: row}}
+		}
+
+		values := make(map[string]interface{}, len(object))
+		for _, member := range object {
+			values[member.Key] = member.Value
+		}
+
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i], err = csvCell(values[column])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = w.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+// csvCell returns the text of a CSV cell. Lists of plain values are joined by genreSeparator, as in movie exports,
+// and objects are written as JSON.
+func csvCell(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		parts := make([]string, len(value))
+		for i, item := range value {
+			switch item.(type) {
+			case jsonObject, []interface{}:
+				js, err := json.Marshal(value)
+				return string(js), err
+			}
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, genreSeparator), nil
+	case jsonObject:
+		js, err := json.Marshal(value)
+		return string(js), err
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+// encodeMsgpack writes the data as MessagePack. Whole numbers are written as integers and others as floats.
+func encodeMsgpack(data envelope) ([]byte, error) {
+	tree, err := jsonTree(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	err = writeMsgpackValue(msgpack.NewEncoder(&buf), tree)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeMsgpackValue(enc *msgpack.Encoder, value interface{}) error {
+	switch value := value.(type) {
+	case jsonObject:
+		err := enc.EncodeMapLen(len(value))
+		if err != nil {
+			return err
+		}
+
+		for _, member := range value {
+			err = enc.EncodeString(member.Key)
+			if err != nil {
+				return err
+			}
+
+			err = writeMsgpackValue(enc, member.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case []interface{}:
+		err := enc.EncodeArrayLen(len(value))
+		if err != nil {
+			return err
+		}
+
+		for _, item := range value {
+			err = writeMsgpackValue(enc, item)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return enc.EncodeInt(i)
+		}
+
+		f, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		return enc.EncodeFloat64(f)
+	}
+
+	return enc.Encode(value)
+}
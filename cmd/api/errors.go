@@ -16,7 +16,7 @@ func (app *application) logError(r *http.Request, err error) {
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
 	env := envelope{"error": message}
 
-	err := app.writeJSON(w, status, env, nil)
+	err := app.writeResponse(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -76,12 +76,40 @@ func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r
 	app.errorResponse(w, r, http.StatusUnauthorized, msg)
 }
 
-// func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
-// 	msg := "your user account must be activated to access this resource"
-// 	app.errorResponse(w, r, http.StatusForbidden, msg)
-// }
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	msg := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, msg)
+}
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	msg := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, msg)
 }
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	msg := fmt.Sprintf("the %q content type is not supported for this resource", r.Header.Get("Content-Type"))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, msg)
+}
+
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request) {
+	msg := "the resource is not available in any of the accepted formats; use json, xml, msgpack or, for lists, csv"
+	app.errorResponse(w, r, http.StatusNotAcceptable, msg)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	msg := "the record has been modified since the version given in the If-Match header"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, msg)
+}
+
+func (app *application) idempotencyKeyReusedResponse(w http.ResponseWriter, r *http.Request) {
+	msg := "the Idempotency-Key header was already used for a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, msg)
+}
+
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	// The first request with the key is still running, so the client should retry shortly.
+	w.Header().Set("Retry-After", "1")
+
+	msg := "a request with the same Idempotency-Key header is still being processed, please try again"
+	app.errorResponse(w, r, http.StatusConflict, msg)
+}
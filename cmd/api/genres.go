@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// canonicalGenres replaces the genres of a movie, which may be given as any alias or spelling of a genre, with the
+// slugs of the genres of the taxonomy. Genres which aren't in the taxonomy are reported in v.
+func (app *application) canonicalGenres(models data.Models, v *validator.Validator, movie *data.Movie) error {
+	if movie.Genres == nil {
+		return nil
+	}
+
+	slugs, err := models.Genres.Resolve(movie.Genres)
+	if err != nil {
+		return err
+	}
+
+	for i, slug := range slugs {
+		if slug == "" {
+			v.AddError("genres", fmt.Sprintf("must only contain known genres (%q is not one)", movie.Genres[i]))
+			return nil
+		}
+	}
+
+	// two aliases of the same genre resolve to the same slug
+	movie.Genres = distinct(slugs)
+
+	return nil
+}
+
+// filterGenres maps the genres of a movie filter, which may be given as any alias or spelling of a genre, onto the
+// slugs of the genres of the taxonomy. Genres which aren't in the taxonomy are only slugified, so they match nothing.
+func (app *application) filterGenres(names []string) ([]string, error) {
+	slugs, err := app.models.Genres.Resolve(names)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, slug := range slugs {
+		if slug == "" {
+			slugs[i] = data.Slugify(names[i])
+		}
+	}
+
+	return distinct(slugs), nil
+}
+
+// distinct returns the values without repeats, in the order each first appears.
+func distinct(values []string) []string {
+	seen := make(map[string]bool, len(values))
+
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// slugifyAll turns genres or aliases into slugs, so that they can be given as they might be typed.
+func slugifyAll(values []string) []string {
+	slugs := []string{}
+	for _, value := range values {
+		slugs = append(slugs, data.Slugify(value))
+	}
+	return slugs
+}
+
+// recordGenreRevisions stores a revision for each movie whose genres were rewritten by the rename or merge of a genre,
+// so that the history of the movie has no gaps. prior holds the movies which had the old genre before the change, and
+// slug is the genre they have now. It should be called with the same transaction as the change.
+func (app *application) recordGenreRevisions(models data.Models, r *http.Request, prior []*data.Movie, slug string) error {
+	movies, err := models.Movies.GetAllForGenre(slug)
+	if err != nil {
+		return err
+	}
+
+	rewritten := make(map[int64]*data.Movie, len(movies))
+	for _, movie := range movies {
+		rewritten[movie.ID] = movie
+	}
+
+	for _, before := range prior {
+		after, ok := rewritten[before.ID]
+		if !ok || after.Version == before.Version {
+			continue
+		}
+
+		err := app.recordRevision(models, r, data.RevisionGenre, before, after)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// genreConflictResponse reports a slug or alias which is already used by another genre.
+func (app *application) genreConflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	v := validator.New()
+
+	switch {
+	case errors.Is(err, data.ErrDuplicateGenreSlug):
+		v.AddError("slug", "is already the slug or an alias of another genre")
+	case errors.Is(err, data.ErrDuplicateGenreAlias):
+		v.AddError("aliases", "must not contain the slug or an alias of another genre")
+	}
+
+	app.failedValidationResponse(w, r, v.Errors)
+}
+
+// listGenresHandler lists the genre taxonomy, with the number of movies in each genre.
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 100, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"id", "slug", "name", "movie_count", "-id", "-slug", "-name", "-movie_count"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	genres, metadata, err := app.models.Genres.GetAll(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genres": genres, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	genre, err := app.models.Genres.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createGenreHandler adds a genre to the taxonomy. The slug defaults to the slugified name.
+func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Slug    string   `json:"slug"`
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	genre := &data.Genre{
+		Slug:    input.Slug,
+		Name:    input.Name,
+		Aliases: slugifyAll(input.Aliases),
+	}
+
+	if genre.Slug == "" {
+		genre.Slug = data.Slugify(genre.Name)
+	}
+
+	v := validator.New()
+	if data.ValidateGenre(v, genre); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		return tx.Genres.Insert(genre)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrDuplicateGenreSlug) || errors.Is(err, data.ErrDuplicateGenreAlias) {
+			app.genreConflictResponse(w, r, err)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/genres/%d", genre.ID))
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"genre": genre}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateGenreHandler renames a genre or changes its aliases. Changing the slug rewrites every movie with the genre,
+// and keeps the old slug as an alias.
+func (app *application) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	genre, err := app.models.Genres.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	oldSlug := genre.Slug
+
+	var input struct {
+		Slug    *string  `json:"slug"`
+		Name    *string  `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		genre.Name = *input.Name
+	}
+
+	if input.Aliases != nil {
+		genre.Aliases = slugifyAll(input.Aliases)
+	}
+
+	// Renaming a genre to one of its aliases turns the alias into the slug.
+	if input.Slug != nil && *input.Slug != genre.Slug {
+		genre.Slug = *input.Slug
+
+		aliases := []string{}
+		for _, alias := range genre.Aliases {
+			if alias != genre.Slug {
+				aliases = append(aliases, alias)
+			}
+		}
+		genre.Aliases = aliases
+	}
+
+	v := validator.New()
+	if data.ValidateGenre(v, genre); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		prior, err := tx.Movies.GetAllForGenre(oldSlug)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Genres.Update(genre)
+		if err != nil {
+			return err
+		}
+
+		genre, err = tx.Genres.Get(id)
+		if err != nil {
+			return err
+		}
+
+		return app.recordGenreRevisions(tx, r, prior, genre.Slug)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.ErrEditConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateGenreSlug), errors.Is(err, data.ErrDuplicateGenreAlias):
+			app.genreConflictResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeGenreHandler folds a genre into another, given by the "into" field, and deletes it. Movies with the merged
+// genre are given the other genre instead, and the merged genre's slug and aliases become aliases of the other genre.
+func (app *application) mergeGenreHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Into int64 `json:"into"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Into > 0, "into", "must be provided")
+	v.Check(input.Into != id, "into", "must not be the genre being merged")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	source, err := app.models.Genres.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var genre *data.Genre
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		prior, err := tx.Movies.GetAllForGenre(source.Slug)
+		if err != nil {
+			return err
+		}
+
+		genre, err = tx.Genres.Merge(id, input.Into)
+		if err != nil {
+			return err
+		}
+
+		return app.recordGenreRevisions(tx, r, prior, genre.Slug)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("into", "must refer to an existing genre")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
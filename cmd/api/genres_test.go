@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalGenres(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	tests := []struct {
+		name       string
+		genres     string
+		wantStatus int
+		wantGenres []interface{}
+	}{
+		{"Slug", `["sci-fi"]`, http.StatusCreated, []interface{}{"sci-fi"}},
+		{"Alias", `["Science Fiction"]`, http.StatusCreated, []interface{}{"sci-fi"}},
+		{"Two aliases of one genre", `["scifi", "SF", "drama"]`, http.StatusCreated, []interface{}{"sci-fi", "drama"}},
+		{"Unknown genre", `["space opera"]`, http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"title": "` + tt.name + `", "year": 2016, "duration": 107, "genres": ` + tt.genres + `}`
+
+			status, _, js := ts.do(http.MethodPost, "/v1/movies", token, body)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			if status != http.StatusCreated {
+				return
+			}
+
+			if genres := js["movie"].(map[string]interface{})["genres"]; !reflect.DeepEqual(genres, tt.wantGenres) {
+				t.Errorf("got genres %v; want %v", genres, tt.wantGenres)
+			}
+		})
+	}
+}
+
+func TestFilterMoviesByGenreAlias(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, `{"title": "Alien", "year": 1979, "duration": 117, "genres": ["sci-fi", "horror"]}`)
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+
+	tests := []struct {
+		name      string
+		query     string
+		wantCount int
+	}{
+		{"Slug", "?genres=sci-fi", 1},
+		{"Alias", "?genres=Science%20Fiction", 1},
+		{"Aliases of one genre", "?genres=scifi,sf", 1},
+		{"Any alias", "?genres_any=sf,animation", 2},
+		{"Unknown genre", "?genres=space-opera", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(http.MethodGet, "/v1/movies"+tt.query, token, "")
+			if status != http.StatusOK {
+				t.Fatalf("got status %d; want %d: %v", status, http.StatusOK, js)
+			}
+
+			if movies := js["movies"].([]interface{}); len(movies) != tt.wantCount {
+				t.Errorf("got %d movies; want %d", len(movies), tt.wantCount)
+			}
+		})
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/lorezi/duxfilm/internal/data"
 	"github.com/lorezi/duxfilm/internal/validator"
 )
 
@@ -28,24 +30,28 @@ func (app *application) getParamID(r *http.Request) (int64, error) {
 
 }
 
-// Converts a Go struct to JSON
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	// encode data to json
-	js, err := json.MarshalIndent(data, "", "\t")
+// writeResponse encodes the data in the format negotiated for the request, and sends it with the status and headers.
+// A CSV response can only hold a list, so other data is answered with 406 Not Acceptable instead.
+func (app *application) writeResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	enc := app.contextGetEncoder(r)
+
+	body, err := enc.encode(data)
 	if err != nil {
+		if errors.Is(err, errNotList) {
+			app.notAcceptableResponse(w, r)
+			return nil
+		}
 		return err
 	}
-	// append newline
-	js = append(js, '\n')
 
 	// loop through the headers map
 	for k, v := range headers {
 		w.Header()[k] = v
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", enc.contentType)
 	w.WriteHeader(status)
-	w.Write(js)
+	w.Write(body)
 
 	return nil
 }
@@ -60,31 +66,8 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	dec.DisallowUnknownFields()
 
 	err := dec.Decode(dst)
-
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
-
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("malformed JSON at character %d", syntaxError.Offset)
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("malformed JSON")
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("request body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("request body contains incorrect JSON type for field %q", unmarshalTypeError.Offset)
-		case errors.Is(err, io.EOF):
-			return errors.New("request body must not be empty")
-		case errors.As(err, &invalidUnmarshalError):
-			panic(err)
-		default:
-			return err
-
-		}
-
+		return triageJSONError(err)
 	}
 
 	err = dec.Decode(&struct{}{})
@@ -95,6 +78,31 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
+// triageJSONError converts an error returned while decoding JSON into a message which is safe to send to the client.
+func triageJSONError(err error) error {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+
+	switch {
+	case errors.As(err, &syntaxError):
+		return fmt.Errorf("malformed JSON at character %d", syntaxError.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errors.New("malformed JSON")
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return fmt.Errorf("request body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		}
+		return fmt.Errorf("request body contains incorrect JSON type for field %q", unmarshalTypeError.Offset)
+	case errors.Is(err, io.EOF):
+		return errors.New("request body must not be empty")
+	case errors.As(err, &invalidUnmarshalError):
+		panic(err)
+	default:
+		return err
+	}
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 
 	s := qs.Get(key)
@@ -133,6 +141,80 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readBool reads a query string value given as true or false, or any other form accepted by strconv.ParseBool().
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return defaultValue
+	}
+
+	return b
+}
+
+// readTime reads a query string value given either as a date (YYYY-MM-DD), taken as midnight UTC, or as an RFC 3339
+// timestamp. A missing value is returned as the zero time.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+
+	s := qs.Get(key)
+
+	if s == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, s)
+	}
+	if err != nil {
+		v.AddError(key, "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+		return time.Time{}
+	}
+
+	return t
+}
+
+// presentMovies writes the titles and durations of the movies in the languages and format requested for the
+// response.
+func (app *application) presentMovies(r *http.Request, movies ...*data.Movie) {
+	format := app.contextGetDurationFormat(r)
+	languages := app.contextGetLanguages(r)
+	for _, movie := range movies {
+		if movie != nil {
+			movie.SetDurationFormat(format)
+			movie.SetLanguages(languages)
+		}
+	}
+}
+
+// extendReadDeadline gives a request until d from now to be read, in place of the server's ReadTimeout, for handlers
+// which accept large bodies. Like extendWriteDeadline(), it leaves requests which didn't come through serve() alone.
+func (app *application) extendReadDeadline(r *http.Request, d time.Duration) error {
+	c, ok := app.contextGetConn(r)
+	if !ok {
+		return nil
+	}
+	return c.SetReadDeadline(time.Now().Add(d))
+}
+
+// extendWriteDeadline gives the response to a request until d from now to be written, in place of the server's
+// WriteTimeout, for handlers which stream large bodies. Requests which didn't come through serve(), such as those of
+// tests, are left alone.
+func (app *application) extendWriteDeadline(r *http.Request, d time.Duration) error {
+	c, ok := app.contextGetConn(r)
+	if !ok {
+		return nil
+	}
+	return c.SetWriteDeadline(time.Now().Add(d))
+}
+
 // The background() helper accepts an arbitrary function as a parameter.
 func (app *application) background(fn func()) {
 	// Increment the WaitGroup counter.
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+const (
+	// idempotencyLockTimeout is how long a request with an Idempotency-Key header holds the key without renewing it
+	// before it is presumed lost, e.g. because the server stopped while running it. A running request renews its key
+	// every half timeout, so that a long import keeps it.
+	idempotencyLockTimeout = time.Minute
+
+	// maxIdempotentBody is the largest body any POST route accepts, that of the movie import.
+	maxIdempotentBody = 104_857_600
+)
+
+// idempotencyExcludedPaths lists the POST routes whose responses hold a credential, such as the plaintext of an
+// authentication token, which must never be stored. They ignore the Idempotency-Key header.
+var idempotencyExcludedPaths = map[string]bool{
+	"/v1/tokens/authentication": true,
+}
+
+// idempotent makes POST requests which carry an Idempotency-Key header safe to retry. The first request with a key
+// runs as usual and its response is stored for the configured window, which a retry with the same key, method, path,
+// query string, content type and body is answered with instead. Reusing the key for a different request is refused
+// with 422 Unprocessable Entity, and a retry which arrives while the first request is still running with 409
+// Conflict. Responses with a 5xx status aren't stored, so that the request can be retried for real.
+//
+// The body is never held in memory: the first request's body is fingerprinted as the handler streams it, and a
+// retry's is read through only to fingerprint it.
+func (app *application) idempotent(next http.Handler) http.Handler {
+	go func() {
+		for {
+			time.Sleep(time.Hour)
+
+			err := app.models.Idempotency.DeleteExpired()
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	}()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" || idempotencyExcludedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v := validator.New()
+		if v.Check(len(key) <= 255, "Idempotency-Key", "must not be more than 255 bytes long"); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		// The fingerprint is only known once the body has been read, and is stored by Complete().
+		record := &data.IdempotencyRecord{
+			UserID:      app.contextGetUser(r).ID,
+			Key:         key,
+			Fingerprint: []byte{},
+			ExpiresAt:   time.Now().Add(idempotencyLockTimeout),
+		}
+
+		existing, err := app.models.Idempotency.Reserve(record)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if existing != nil {
+			if existing.Status == 0 {
+				app.idempotencyKeyInUseResponse(w, r)
+				return
+			}
+
+			h := fingerprintHash(r)
+			_, err := io.Copy(h, http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+			if err != nil {
+				app.badRequestResponse(w, r, err)
+				return
+			}
+
+			if !bytes.Equal(existing.Fingerprint, h.Sum(nil)) {
+				app.idempotencyKeyReusedResponse(w, r)
+				return
+			}
+
+			addHeaders(w.Header(), existing.Header)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(existing.Status)
+			w.Write(existing.Body)
+			return
+		}
+
+		// Unless the response is stored, the key is given up again, even if the handler panics.
+		completed := false
+		defer func() {
+			if !completed {
+				err := app.models.Idempotency.Release(record.UserID, record.Key)
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+		}()
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go app.renewIdempotencyKey(record.UserID, record.Key, stop)
+
+		body := &fingerprintReader{ReadCloser: http.MaxBytesReader(w, r.Body, maxIdempotentBody), h: fingerprintHash(r)}
+		r.Body = body
+
+		rec := &idempotencyRecorder{ResponseWriter: w, header: make(http.Header)}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.WriteHeader(http.StatusOK)
+		}
+		if rec.status >= 500 {
+			return
+		}
+
+		// Whatever the handler left unread is fingerprinted too. If it can't be read the response isn't stored, as a
+		// retry couldn't be told apart from a different request.
+		_, err = io.Copy(io.Discard, body)
+		if err != nil {
+			return
+		}
+
+		record.Fingerprint = body.h.Sum(nil)
+		record.Status = rec.status
+		record.Header = rec.header
+		record.Body = rec.body.Bytes()
+		record.ExpiresAt = time.Now().Add(app.config.idempotency.ttl)
+
+		err = app.models.Idempotency.Complete(record)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		completed = true
+	})
+}
+
+// renewIdempotencyKey extends the reservation of a key every half lock timeout until stop is closed.
+func (app *application) renewIdempotencyKey(userID int64, key string, stop <-chan struct{}) {
+	ticker := time.NewTicker(idempotencyLockTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := app.models.Idempotency.Renew(userID, key, time.Now().Add(idempotencyLockTimeout))
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"idempotency_key": key})
+			}
+		}
+	}
+}
+
+// fingerprintHash returns a hash holding the parts of a request, besides its body, which a retry must repeat to be
+// answered with the stored response. The body is written to it after them.
+func fingerprintHash(r *http.Request) hash.Hash {
+	h := sha256.New()
+
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	io.WriteString(h, r.Header.Get("Content-Type")+"\n")
+
+	return h
+}
+
+// fingerprintReader passes a request body through to the handler while writing it to the hash of the request's
+// fingerprint.
+type fingerprintReader struct {
+	io.ReadCloser
+	h hash.Hash
+}
+
+func (fr *fingerprintReader) Read(p []byte) (int, error) {
+	n, err := fr.ReadCloser.Read(p)
+	fr.h.Write(p[:n])
+	return n, err
+}
+
+// addHeaders appends the values of the headers in src to dst.
+func addHeaders(dst, src http.Header) {
+	for name, values := range src {
+		dst[name] = append(dst[name], values...)
+	}
+}
+
+// idempotencyRecorder passes a response through to the client while keeping a copy of it. The handler sets its
+// headers on a map of their own, so that only they are stored, and not those of the middleware around it.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+
+	rec.status = status
+	addHeaders(rec.ResponseWriter.Header(), rec.header)
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
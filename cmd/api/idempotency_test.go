@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+	bob := ts.newUser("bob@example.com", true, "movies:read", "movies:write")
+
+	post := func(token, key, url, body string) (int, http.Header, map[string]interface{}) {
+		t.Helper()
+
+		r := newTestRequest(http.MethodPost, url, token, body)
+		r.Header.Set("Idempotency-Key", key)
+
+		return ts.send(r)
+	}
+
+	status, header, first := post(alice, "create-moana", "/v1/movies", testMovie)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusCreated, first)
+	}
+
+	if header.Get("Idempotent-Replayed") != "" {
+		t.Error("the first request was marked as replayed")
+	}
+
+	// A retry is answered with the stored response rather than creating the movie again.
+	status, header, retry := post(alice, "create-moana", "/v1/movies", testMovie)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d for the retry; want %d: %v", status, http.StatusCreated, retry)
+	}
+
+	if header.Get("Idempotent-Replayed") != "true" || header.Get("Location") != "/v1/movies/1" {
+		t.Errorf("got headers %v for the retry", header)
+	}
+
+	if retry["movie"].(map[string]interface{})["id"] != first["movie"].(map[string]interface{})["id"] {
+		t.Errorf("got movie %v for the retry; want %v", retry["movie"], first["movie"])
+	}
+
+	if stored := ts.countMovies(); stored != 1 {
+		t.Errorf("got %d movies stored; want 1", stored)
+	}
+
+	tests := []struct {
+		name         string
+		token        string
+		key          string
+		url          string
+		body         string
+		wantStatus   int
+		wantReplayed bool
+	}{
+		{"Different body", alice, "create-moana", "/v1/movies", `{"title": "Up", "year": 2009, "duration": 96, "genres": ["animation"]}`, http.StatusUnprocessableEntity, false},
+		{"Different query string", alice, "create-moana", "/v1/movies?allow_duplicate=true", testMovie, http.StatusUnprocessableEntity, false},
+		// Keys belong to the user who sent them.
+		{"Other user", bob, "create-moana", "/v1/movies", `{"title": "Up", "year": 2009, "duration": 96, "genres": ["animation"]}`, http.StatusCreated, false},
+		// Responses to client errors are stored too.
+		{"Failed request", alice, "create-invalid", "/v1/movies", `{"title": ""}`, http.StatusUnprocessableEntity, false},
+		{"Failed request retried", alice, "create-invalid", "/v1/movies", `{"title": ""}`, http.StatusUnprocessableEntity, true},
+		{"Key too long", alice, strings.Repeat("k", 256), "/v1/movies", testMovie, http.StatusUnprocessableEntity, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, js := post(tt.token, tt.key, tt.url, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			if replayed := header.Get("Idempotent-Replayed") == "true"; replayed != tt.wantReplayed {
+				t.Errorf("got replayed %t; want %t", replayed, tt.wantReplayed)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyInUse(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	user, err := ts.app.models.User.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key is held by a request which is still running.
+	existing, err := ts.app.models.Idempotency.Reserve(&data.IdempotencyRecord{
+		UserID:      user.ID,
+		Key:         "create-moana",
+		Fingerprint: []byte{},
+		ExpiresAt:   time.Now().Add(time.Minute),
+	})
+	if err != nil || existing != nil {
+		t.Fatalf("got %v and error %v reserving the key", existing, err)
+	}
+
+	r := newTestRequest(http.MethodPost, "/v1/movies", token, testMovie)
+	r.Header.Set("Idempotency-Key", "create-moana")
+
+	status, header, js := ts.send(r)
+	if status != http.StatusConflict {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusConflict, js)
+	}
+
+	if header.Get("Retry-After") == "" {
+		t.Error("missing Retry-After header")
+	}
+
+	if stored := ts.countMovies(); stored != 0 {
+		t.Errorf("got %d movies stored; want 0", stored)
+	}
+
+	// Once the reservation is given up, the request runs.
+	err = ts.app.models.Idempotency.Release(user.ID, "create-moana")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r = newTestRequest(http.MethodPost, "/v1/movies", token, testMovie)
+	r.Header.Set("Idempotency-Key", "create-moana")
+
+	status, _, js = ts.send(r)
+	if status != http.StatusCreated {
+		t.Fatalf("got status %d after the release; want %d: %v", status, http.StatusCreated, js)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/lorezi/duxfilm/internal/blob"
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// imagesPath is the path below which serveImageHandler serves the blobs of the local store. negotiate() leaves it
+// alone, as images aren't encoded.
+const imagesPath = "/v1/images"
+
+// maxImageDimension is the largest width or height of an upload, which keeps the memory needed to decode and resize
+// it in bounds.
+const maxImageDimension = 5000
+
+// imageContentTypes maps the content types which can be uploaded, as sniffed from the data, to the extension of
+// their blobs.
+var imageContentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// thumbnailSize is a width images are resized to, keeping their aspect ratio.
+type thumbnailSize struct {
+	name  string
+	width int
+}
+
+// imageRules holds, for each kind of image, the smallest size an upload may have and the thumbnails made of it.
+var imageRules = map[string]struct {
+	minWidth, minHeight int
+	thumbnails          []thumbnailSize
+}{
+	"poster":   {minWidth: 300, minHeight: 450, thumbnails: []thumbnailSize{{"small", 154}, {"medium", 342}}},
+	"backdrop": {minWidth: 780, minHeight: 439, thumbnails: []thumbnailSize{{"small", 300}, {"medium", 780}}},
+}
+
+// getMovieImagesHandler lists the images of a movie by kind.
+func (app *application) getMovieImagesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.movieNotFoundResponse(w, r, id)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	images := movie.Images
+	if images == nil {
+		images = data.MovieImages{}
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"images": images}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// uploadMovieImageHandler stores the image in the "image" part of a multipart/form-data request as the poster or
+// backdrop of a movie, along with its thumbnails, replacing any image of that kind the movie already had.
+func (app *application) uploadMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+	if !validator.In(kind, data.ImageKinds...) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	upload, err := app.readImageUpload(w, r, v)
+	if err != nil {
+		if errors.Is(err, http.ErrNotMultipart) {
+			app.unsupportedMediaTypeResponse(w, r)
+			return
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	src, contentType := validateImage(v, kind, upload)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img, blobs, err := app.newImage(id, kind, upload, src, contentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.putBlobs(blobs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	prior, err := app.models.Images.Set(id, kind, img)
+	if err != nil {
+		app.deleteBlobs(img.Keys()...)
+
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if prior != nil {
+		app.deleteBlobs(prior.Keys()...)
+		status = http.StatusOK
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/images/%s", id, kind))
+
+	err = app.writeResponse(w, r, status, envelope{"image": img}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteMovieImageHandler removes the poster or backdrop of a movie, along with its blobs.
+func (app *application) deleteMovieImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+	if !validator.In(kind, data.ImageKinds...) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	prior, err := app.models.Images.Remove(id, kind)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.deleteBlobs(prior.Keys()...)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "image successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// serveImageHandler serves the blobs of the local store. Keys are never reused, so the blobs can be cached forever.
+func (app *application) serveImageHandler(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(httprouter.ParamsFromContext(r.Context()).ByName("key"), "/")
+
+	f, err := app.blobs.Open(key)
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) || errors.Is(err, blob.ErrInvalidKey) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	io.Copy(w, f)
+}
+
+// readImageUpload reads the "image" part of a multipart/form-data request body, which must not be larger than the
+// configured maximum. Other parts are ignored. A missing or oversized image is reported in v, while a body which
+// isn't multipart or can't be read is returned as an error.
+func (app *application) readImageUpload(w http.ResponseWriter, r *http.Request, v *validator.Validator) ([]byte, error) {
+	maxSize := app.config.images.maxSize
+
+	// Leave room for the boundaries and headers of the parts.
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1_048_576)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FormName() != "image" {
+			continue
+		}
+
+		upload, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		if err != nil {
+			return nil, err
+		}
+
+		v.Check(len(upload) > 0, "image", "must not be empty")
+		v.Check(int64(len(upload)) <= maxSize, "image", fmt.Sprintf("must not be larger than %d bytes", maxSize))
+
+		return upload, nil
+	}
+
+	v.AddError("image", "must be provided")
+
+	return nil, nil
+}
+
+// validateImage checks the type and dimensions of an upload, and decodes it. The content type is sniffed from the
+// data rather than trusted from the request.
+func validateImage(v *validator.Validator, kind string, upload []byte) (image.Image, string) {
+	contentType := http.DetectContentType(upload)
+	if _, ok := imageContentTypes[contentType]; !ok {
+		v.AddError("image", "must be a JPEG, PNG or GIF image")
+		return nil, ""
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(upload))
+	if err != nil {
+		v.AddError("image", "could not be decoded")
+		return nil, ""
+	}
+
+	rule := imageRules[kind]
+
+	if v.Check(config.Width >= rule.minWidth && config.Height >= rule.minHeight, "image", fmt.Sprintf("must be at least %dx%d pixels", rule.minWidth, rule.minHeight)); !v.Valid() {
+		return nil, ""
+	}
+	if v.Check(config.Width <= maxImageDimension && config.Height <= maxImageDimension, "image", fmt.Sprintf("must not be wider or taller than %d pixels", maxImageDimension)); !v.Valid() {
+		return nil, ""
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(upload))
+	if err != nil {
+		v.AddError("image", "could not be decoded")
+		return nil, ""
+	}
+
+	return src, contentType
+}
+
+// newImage describes an upload and its thumbnails, and returns the blobs to store by key. Every upload gets new keys,
+// so that a replaced image is never served from a cache.
+func (app *application) newImage(movieID int64, kind string, upload []byte, src image.Image, contentType string) (*data.Image, map[string][]byte, error) {
+	suffix := make([]byte, 8)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prefix := fmt.Sprintf("movies/%d/%s-%s", movieID, kind, hex.EncodeToString(suffix))
+	bounds := src.Bounds()
+
+	img := &data.Image{
+		Key:         prefix + imageContentTypes[contentType],
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Size:        int64(len(upload)),
+		Thumbnails:  []data.Thumbnail{},
+		CreatedAt:   time.Now().Truncate(time.Second),
+	}
+	img.URL = app.blobs.URL(img.Key)
+
+	blobs := map[string][]byte{img.Key: upload}
+
+	for _, size := range imageRules[kind].thumbnails {
+		resized := resizeImage(src, size.width)
+
+		var buf bytes.Buffer
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		thumbnail := data.Thumbnail{
+			Name:   size.name,
+			Key:    fmt.Sprintf("%s-%s.jpg", prefix, size.name),
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+		}
+		thumbnail.URL = app.blobs.URL(thumbnail.Key)
+
+		img.Thumbnails = append(img.Thumbnails, thumbnail)
+		blobs[thumbnail.Key] = buf.Bytes()
+	}
+
+	return img, blobs, nil
+}
+
+// putBlobs stores the blobs of an image. If any of them can't be stored, those already stored are deleted again.
+func (app *application) putBlobs(blobs map[string][]byte) error {
+	stored := []string{}
+
+	for key, content := range blobs {
+		err := app.blobs.Put(key, bytes.NewReader(content))
+		if err != nil {
+			app.deleteBlobs(stored...)
+			return err
+		}
+		stored = append(stored, key)
+	}
+
+	return nil
+}
+
+// deleteBlobs deletes the blobs of images which are no longer used. Failures are logged rather than returned, as
+// the images are already gone from the database and a leftover blob does no harm.
+func (app *application) deleteBlobs(keys ...string) {
+	for _, key := range keys {
+		err := app.blobs.Delete(key)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"blob_key": key})
+		}
+	}
+}
+
+// resizeImage scales an image down to the width, keeping its aspect ratio, by averaging the source pixels covered by
+// each pixel of the result. An image which is already narrow enough keeps its size.
+func resizeImage(src image.Image, width int) *image.RGBA {
+	bounds := src.Bounds()
+	if width > bounds.Dx() {
+		width = bounds.Dx()
+	}
+
+	height := (bounds.Dy()*width + bounds.Dx()/2) / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	// Drawing the source onto white converts it to RGBA in one pass, and flattens any transparency, which JPEG
+	// can't hold.
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0, y1 := y*bounds.Dy()/height, (y+1)*bounds.Dy()/height
+		if y1 == y0 {
+			y1++
+		}
+
+		for x := 0; x < width; x++ {
+			x0, x1 := x*bounds.Dx()/width, (x+1)*bounds.Dx()/width
+			if x1 == x0 {
+				x1++
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
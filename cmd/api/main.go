@@ -14,6 +14,7 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/lorezi/duxfilm/internal/blob"
 	"github.com/lorezi/duxfilm/internal/data"
 	"github.com/lorezi/duxfilm/internal/jsonlog"
 	"github.com/lorezi/duxfilm/internal/mailer"
@@ -28,9 +29,10 @@ var (
 // Define a config struct to hold all the configuration settings for out application
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port    int
+	env     string
+	storage string
+	db      struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -40,6 +42,9 @@ type config struct {
 		rps     float64 // request per second
 		burst   int
 		enabled bool
+		// suggestRPS and suggestBurst make up the separate budget of GET /v1/movies/suggest.
+		suggestRPS   float64
+		suggestBurst int
 	}
 	smtp struct {
 		host     string
@@ -48,6 +53,20 @@ type config struct {
 		password string
 		sender   string
 	}
+	// images holds where uploaded images are stored and how large they may be.
+	images struct {
+		dir     string
+		baseURL string
+		maxSize int64
+	}
+	// idempotency holds how long the responses to requests with an Idempotency-Key header are kept for retries.
+	idempotency struct {
+		ttl time.Duration
+	}
+	// trash holds how long deleted movies are kept before they can be purged.
+	trash struct {
+		retention time.Duration
+	}
 	// cors struct and trustedOrigins field with the type []string.
 	cors struct {
 		trustedOrigins []string
@@ -60,6 +79,7 @@ type application struct {
 	logger *jsonlog.Logger
 	models data.Models
 	mailer mailer.Mailer
+	blobs  blob.Store
 	wg     sync.WaitGroup
 }
 
@@ -80,6 +100,7 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 3000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.StringVar(&cfg.storage, "storage", "postgres", "Storage backend (postgres|memory)")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", dsn, "PostgreSQL DSN")
 
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", maxOpenConns, "PostgreSQL max open connections")
@@ -89,6 +110,16 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.limiter.suggestRPS, "limiter-suggest-rps", 5, "Rate limiter maximum title suggestions per second")
+	flag.IntVar(&cfg.limiter.suggestBurst, "limiter-suggest-burst", 10, "Rate limiter maximum title suggestions burst")
+
+	flag.StringVar(&cfg.images.dir, "images-dir", "./uploads", "Directory uploaded images are stored in")
+	flag.StringVar(&cfg.images.baseURL, "images-base-url", imagesPath, "Base URL uploaded images are served from")
+	flag.Int64Var(&cfg.images.maxSize, "images-max-size", 10<<20, "Largest image upload in bytes")
+
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key header are kept for retries")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies are kept before they can be purged")
 
 	// SMTP Server Setup
 	flag.StringVar(&cfg.smtp.host, "smtp-host", os.Getenv("SMTP_HOST"), "SMTP host")
@@ -121,13 +152,38 @@ func main() {
 	// Initialize a new jsonlog.Logger which writes any messages at or above the INFO severity level to the standard out stream
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
-	db, err := OpenDB(cfg)
+	var models data.Models
+
+	// The memory backend keeps everything in process memory, which is handy for local demos.
+	switch cfg.storage {
+	case "memory":
+		models = data.NewMemoryModels()
+
+		logger.PrintInfo("using in-memory storage", nil)
+	case "postgres":
+		db, err := OpenDB(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		defer db.Close()
+
+		logger.PrintInfo("database connection pool established", nil)
+
+		models = data.NewModels(db)
+
+		// Publish the database connection pool statistics
+		expvar.Publish("database", expvar.Func(func() interface{} {
+			return db.Stats()
+		}))
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown storage backend %q", cfg.storage), nil)
+	}
+
+	// Uploaded images are kept on the local filesystem and served by the API itself.
+	blobs, err := blob.NewLocal(cfg.images.dir, cfg.images.baseURL)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
-	defer db.Close()
-
-	logger.PrintInfo("database connection pool established", nil)
 
 	// Publist a new "version" variable in the expvar handler containing our application version number
 	expvar.NewString("version").Set(version)
@@ -137,11 +193,6 @@ func main() {
 		return runtime.NumGoroutine()
 	}))
 
-	// Publish the database connection pool statistics
-	expvar.Publish("database", expvar.Func(func() interface{} {
-		return db.Stats()
-	}))
-
 	// Publish the current Unix timestamp
 	expvar.Publish("timestamp", expvar.Func(func() interface{} {
 		return time.Now().Unix()
@@ -151,8 +202,9 @@ func main() {
 	app := &application{
 		config: cfg,
 		logger: logger,
-		models: data.NewModels(db),
+		models: models,
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		blobs:  blobs,
 	}
 
 	// Call app.serve() to start the server
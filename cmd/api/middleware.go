@@ -4,6 +4,7 @@ import (
 	"errors"
 	"expvar"
 	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"github.com/lorezi/duxfilm/internal/data"
 	"github.com/lorezi/duxfilm/internal/validator"
 	"github.com/tomasen/realip"
+	"golang.org/x/text/language"
 	"golang.org/x/time/rate"
 )
 
@@ -76,19 +78,25 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		if app.config.limiter.enabled {
 			ip := realip.FromRequest(r)
 
+			// Title suggestions are requested on every keystroke, so they are counted against a budget of their own
+			// rather than the general one, under a separate key for the same IP address.
+			key, rps, burst := ip, app.config.limiter.rps, app.config.limiter.burst
+			if r.URL.Path == suggestMoviesPath {
+				key, rps, burst = "suggest "+ip, app.config.limiter.suggestRPS, app.config.limiter.suggestBurst
+			}
+
 			// Lock the mutex to prevent this code from being executed
 			mu.Lock()
 
-			// Check the see if the IP address already exists in the map. If it doesn't, then initialize a new rate limiter and add the IP address and limiter to the map.
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(
-						rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
+			// Check the see if the client already exists in the map. If it doesn't, then initialize a new rate limiter and add the client and limiter to the map.
+			if _, found := clients[key]; !found {
+				clients[key] = &client{
+					limiter: rate.NewLimiter(rate.Limit(rps), burst)}
 			}
 
-			clients[ip].lastSeen = time.Now()
+			clients[key].lastSeen = time.Now()
 
-			if !clients[ip].limiter.Allow() {
+			if !clients[key].limiter.Allow() {
 				mu.Unlock()
 				app.rateLimitExceededResponse(w, r)
 				return
@@ -239,12 +247,16 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 					// response header with the request origin as the value.
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 
+					// Let browser clients read the entity tags used for conditional requests, and tell replayed
+					// responses to idempotent requests apart.
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed")
+
 					// Check if the request has the HTTP method OPTIONS and contains the "Access-Control-Request-Method" header.
 					// If it does, then we treat it as a preflight request.
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						// Set the necessary preflight response headers, as discussed previously.
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key, If-Match, If-None-Match")
 
 						// Write the headers along with a 200 OK status and return from the middleware with no further action.
 						w.WriteHeader(http.StatusOK)
@@ -258,6 +270,98 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 	})
 }
 
+// negotiate chooses the format of the response from the format query string parameter or the Accept header, and
+// answers 406 Not Acceptable up front when it can't be met. CSV is only offered for reading lists, so other methods
+// can't request it. The movie export is left alone, as it streams formats of its own selected by the same parameter,
+// and so are the images, which are served as they were uploaded.
+func (app *application) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == exportMoviesPath || strings.HasPrefix(r.URL.Path, imagesPath+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+
+		enc := negotiateEncoder(r.URL.Query().Get("format"), r.Header.Get("Accept"))
+		if enc == nil || (enc == csvEncoder && r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			app.notAcceptableResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, app.contextSetEncoder(r, enc))
+	})
+}
+
+// durationFormat reads the format durations are written in from the duration_format query string parameter or,
+// failing that, a "duration-<format>" profile in the Accept header, such as
+// Accept: application/json;profile="duration-iso8601". Profiles which aren't recognised are ignored.
+func (app *application) durationFormat(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("duration_format")
+
+		if format != "" {
+			v := validator.New()
+			if v.Check(validator.In(format, data.DurationFormats...), "duration_format", "must be one of minutes, mins, hm or iso8601"); !v.Valid() {
+				app.failedValidationResponse(w, r, v.Errors)
+				return
+			}
+		} else {
+			format = acceptedDurationFormat(r.Header.Get("Accept"))
+		}
+
+		next.ServeHTTP(w, app.contextSetDurationFormat(r, data.DurationFormat(format)))
+	})
+}
+
+// acceptedDurationFormat returns the duration format named by the first "duration-<format>" profile of an Accept
+// header, or "" if there is none.
+func acceptedDurationFormat(accept string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		_, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+
+		for _, profile := range strings.Fields(params["profile"]) {
+			format := strings.TrimPrefix(profile, "duration-")
+			if format != profile && validator.In(format, data.DurationFormats...) {
+				return format
+			}
+		}
+	}
+
+	return ""
+}
+
+// titleLanguages reads the languages movie titles are written in, most preferred first, from the lang query string
+// parameter, a comma-separated list of BCP 47 language tags, or failing that the Accept-Language header. A malformed
+// Accept-Language header is ignored, leaving the titles in their original language.
+func (app *application) titleLanguages(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Language")
+
+		var languages []language.Tag
+
+		if lang := r.URL.Query().Get("lang"); lang != "" {
+			for _, s := range strings.Split(lang, ",") {
+				tag, err := language.Parse(strings.TrimSpace(s))
+				if err != nil {
+					v := validator.New()
+					v.AddError("lang", "must be a comma-separated list of BCP 47 language tags")
+					app.failedValidationResponse(w, r, v.Errors)
+					return
+				}
+				languages = append(languages, tag)
+			}
+		} else {
+			languages, _, _ = language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+		}
+
+		next.ServeHTTP(w, app.contextSetLanguages(r, languages))
+	})
+}
+
 func (app *application) metrics(next http.Handler) http.Handler {
 	// Initialize the new expvar variables when the middleware chain in first built.
 	totalRequestReceived := expvar.NewInt("total_requests_received")
@@ -3,30 +3,75 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
 
 	"github.com/lorezi/duxfilm/internal/data"
 	"github.com/lorezi/duxfilm/internal/validator"
 )
 
+// movieSortSafelist holds the values accepted by the sort parameter of the movie list endpoints, e.g "title", "-title".
+// relevance lists the best matches of the title search first.
+var movieSortSafelist = []string{
+	"id", "title", "year", "duration", "rating_average", "rating_count", "relevance",
+	"-id", "-title", "-year", "-duration", "-rating_average", "-rating_count", "-relevance",
+}
+
 func (app *application) getMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.getParamID(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
-	movie, err := app.models.Movies.Get(id)
+
+	// selected fields and embedded resources
+	v := validator.New()
+	shape := app.readMovieShape(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.GetFields(id, shape.columns())
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
-			app.notFoundResponse(w, r)
+			app.movieNotFoundResponse(w, r, id)
 			return
 		}
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	embeds, err := app.movieEmbeds([]*data.Movie{movie}, shape)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag, err := shape.etag(app.movieETag(r, movie, shape), embeds)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// answer 304 Not Modified if the client already holds this version
+	if app.notModified(w, r, etag) {
+		return
+	}
+
+	app.presentMovies(r, movie)
+
+	shaped, err := shape.shape(movie, embeds[0])
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// encode the movie data
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": shaped}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -38,35 +83,62 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	// 1. Read JSON to Object
 	err := app.readJSON(w, r, &req)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.readMovieErrorResponse(w, r, err)
 		return
 	}
 
 	movie := &data.Movie{
-		Title:    req.Title,
-		Year:     req.Year,
-		Duration: int32(req.Duration),
-		Genres:   req.Genres,
+		Title:            req.Title,
+		OriginalLanguage: req.OriginalLanguage,
+		Titles:           req.Titles,
+		Year:             req.Year,
+		Duration:         int32(req.Duration),
+		Genres:           req.Genres,
 	}
 
 	//2. Validate the data
 	v := validator.New()
 
+	// a likely duplicate is refused unless the client insists
+	allowDuplicate := app.readBool(r.URL.Query(), "allow_duplicate", false, v)
+
+	// map the genres onto the taxonomy
+	err = app.canonicalGenres(app.models, v, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	// 3. Store the data
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	err = app.models.Movies.Insert(movie)
+
+	var duplicates []*data.Movie
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		var err error
+		duplicates, err = app.insertMovie(tx, r, movie, allowDuplicate)
+		return err
+	})
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	if len(duplicates) > 0 {
+		app.duplicateMovieResponse(w, r, duplicates)
+		return
+	}
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", app.movieETag(r, movie, movieShape{}))
+
+	app.presentMovies(r, movie)
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"movie": movie}, headers)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -89,52 +161,116 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	var input struct {
-		Title    *string        `json:"title"`
-		Year     *int32         `json:"year"`
-		Duration *data.Duration `json:"duration"`
-		Genres   []string       `json:"genres"`
-	}
-
-	// read the json req body into the input struct
-	err = app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	if !app.preconditionMet(r, movie) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
+	// keep the current state for the revision history
+	prior := *movie
 
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
+	v := validator.New()
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "", "application/json":
+		var input struct {
+			Title            *string          `json:"title"`
+			OriginalLanguage *string          `json:"original_language"`
+			Titles           data.MovieTitles `json:"titles"`
+			Year             *int32           `json:"year"`
+			Duration         *data.Duration   `json:"duration"`
+			Genres           []string         `json:"genres"`
+		}
 
-	if input.Duration != nil {
-		movie.Duration = int32(*input.Duration)
+		// read the json req body into the input struct
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.readMovieErrorResponse(w, r, err)
+			return
+		}
+
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+
+		if input.OriginalLanguage != nil {
+			movie.OriginalLanguage = *input.OriginalLanguage
+		}
+
+		// the translations are replaced as a whole
+		if input.Titles != nil {
+			movie.Titles = input.Titles
+		}
+
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+
+		if input.Duration != nil {
+			movie.Duration = int32(*input.Duration)
+		}
+
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+	case mergePatchMediaType, jsonPatchMediaType:
+		err = app.patchMovie(w, r, mediaType, movie, v)
+		if err != nil {
+			if errors.Is(err, errPatchTestFailed) {
+				app.errorResponse(w, r, http.StatusConflict, err.Error())
+				return
+			}
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	// map changed genres onto the taxonomy
+	if !reflect.DeepEqual(movie.Genres, prior.Genres) {
+		err = app.canonicalGenres(app.models, v, movie)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 	}
 
-	v := validator.New()
 	if data.ValidateMovie(v, movie); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.models.Atomic(func(tx data.Models) error {
+		err := tx.Movies.Update(movie)
+		if err != nil {
+			return err
+		}
+		return app.recordRevision(tx, r, data.RevisionUpdate, &prior, movie)
+	})
 	if err != nil {
 		if errors.Is(err, data.ErrEditConflict) {
-			app.ErrEditConflictResponse(w, r)
+			app.editConflictResponse(w, r)
 			return
 		}
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", app.movieETag(r, movie, movieShape{}))
+
+	app.presentMovies(r, movie)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -147,7 +283,7 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	movie, err := app.models.Movies.Get(id)
 	if err != nil {
 		if errors.Is(err, data.ErrRecordNotFound) {
 			app.notFoundResponse(w, r)
@@ -157,17 +293,99 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	if !app.preconditionMet(r, movie) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	prior := *movie
 
+	err = app.models.Atomic(func(tx data.Models) error {
+		err := tx.Movies.Delete(movie)
+		if err != nil {
+			return err
+		}
+		return app.recordRevision(tx, r, data.RevisionDelete, &prior, movie)
+	})
 	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "movie successfully moved to the trash"}, nil)
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieErrorResponse reports a movie request body which couldn't be read. A duration in an unknown format is
+// reported against the duration field, with the formats which are accepted.
+func (app *application) readMovieErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, data.ErrInvalidDurationFormat) {
+		app.failedValidationResponse(w, r, map[string]string{"duration": data.DurationFormatHelp})
+		return
+	}
+
+	app.badRequestResponse(w, r, err)
+}
+
+// readMovieFilter reads the query string parameters which select the movies of a list, and validates them. The
+// genres are looked up in the taxonomy, which is the only way it can fail.
+func (app *application) readMovieFilter(qs url.Values, v *validator.Validator) (data.MovieFilter, error) {
+	filter := data.MovieFilter{
+		Title: app.readString(qs, "title", ""),
+		// the ids of a person credited as director or actor
+		Director: int64(app.readInt(qs, "director", 0, v)),
+		Actor:    int64(app.readInt(qs, "actor", 0, v)),
+		// the id of a collection the movie belongs to
+		Collection: int64(app.readInt(qs, "collection_id", 0, v)),
+		// inclusive ranges
+		YearMin:     int32(app.readInt(qs, "year_min", 0, v)),
+		YearMax:     int32(app.readInt(qs, "year_max", 0, v)),
+		DurationMin: int32(app.readInt(qs, "duration_min", 0, v)),
+		DurationMax: int32(app.readInt(qs, "duration_max", 0, v)),
+		// created_after is inclusive and created_before exclusive
+		CreatedAfter:  app.readTime(qs, "created_after", v),
+		CreatedBefore: app.readTime(qs, "created_before", v),
+	}
+
+	// a typo-tolerant title search, which also matches the beginnings of words
+	if s := qs.Get("fuzzy"); s != "" {
+		fuzzy, err := strconv.ParseBool(s)
+		if err != nil {
+			v.AddError("fuzzy", "must be true or false")
+		}
+		filter.Fuzzy = fuzzy
+	}
+
+	data.ValidateMovieFilter(v, filter)
+
+	// every one of genres, or at least one of genres_any, as slugs
+	var err error
+
+	filter.Genres, err = app.filterGenres(app.readCSV(qs, "genres", []string{}))
+	if err != nil {
+		return data.MovieFilter{}, err
+	}
+
+	filter.GenresAny, err = app.filterGenres(app.readCSV(qs, "genres_any", []string{}))
+	if err != nil {
+		return data.MovieFilter{}, err
 	}
+
+	return filter, nil
 }
 
 func (app *application) getMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieFilter
+		Facets []string
+		Shape  movieShape
 		data.Filters
 	}
 
@@ -176,30 +394,82 @@ func (app *application) getMoviesHandler(w http.ResponseWriter, r *http.Request)
 	qs := r.URL.Query()
 
 	// returned resource
-	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	filter, err := app.readMovieFilter(qs, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.MovieFilter = filter
+
+	// opt-in counts of the values of each facet over the whole result set
+	input.Facets = app.readCSV(qs, "facets", []string{})
+	for _, facet := range input.Facets {
+		v.Check(validator.In(facet, data.FacetSafelist...), "facets", "invalid facet value")
+	}
+	v.Check(validator.Unique(input.Facets), "facets", "must not contain duplicate values")
+
+	// selected fields and embedded resources
+	input.Shape = app.readMovieShape(qs, v)
+	input.Filters.Fields = input.Shape.columns()
 
 	// pagination
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 5, v)
+	// keyset pagination, using a cursor returned in the metadata of a previous page
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
 
 	// sorting
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	// sort by ONLY the following query parameters e.g "title", "-title"
-	input.Filters.SortSafelist = []string{"id", "title", "year", "duration", "-id", "-title", "-year", "-duration"}
+	// sort by ONLY the following query parameters
+	input.Filters.SortSafelist = movieSortSafelist
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieFilter, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if len(input.Facets) > 0 {
+		metadata.Facets, err = app.models.Movies.Facets(input.MovieFilter, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	embeds, err := app.movieEmbeds(movies, input.Shape)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag, err := input.Shape.etag(app.moviesETag(r, movies, metadata, input.Shape), embeds)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if app.notModified(w, r, etag) {
+		return
+	}
+
+	app.presentMovies(r, movies...)
+
+	shaped := make([]interface{}, len(movies))
+	for i, movie := range movies {
+		shaped[i], err = input.Shape.shape(movie, embeds[i])
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movies": shaped, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
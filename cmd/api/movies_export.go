@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// exportMoviesPath is the path of exportMoviesHandler, which negotiate() leaves to choose its own format.
+const exportMoviesPath = "/v1/movies/export"
+
+// movieRowWriter writes the movies of an export one row at a time. Rows may be buffered until Flush() is called.
+type movieRowWriter interface {
+	Write(movie *data.Movie) error
+	Flush() error
+}
+
+// csvMovieWriter writes the columns listed in movieCSVHeader, with the duration in minutes, the genres joined by
+// genreSeparator and the translated titles as a JSON object.
+type csvMovieWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVMovieWriter(w io.Writer) (*csvMovieWriter, error) {
+	cw := &csvMovieWriter{writer: csv.NewWriter(w)}
+
+	err := cw.writer.Write(movieCSVHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+func (cw *csvMovieWriter) Write(movie *data.Movie) error {
+	titles := ""
+	if len(movie.Titles) > 0 {
+		js, err := json.Marshal(movie.Titles)
+		if err != nil {
+			return err
+		}
+		titles = string(js)
+	}
+
+	return cw.writer.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.Title,
+		movie.OriginalLanguage,
+		titles,
+		strconv.FormatInt(int64(movie.Year), 10),
+		strconv.FormatInt(int64(movie.Duration), 10),
+		strings.Join(movie.Genres, genreSeparator),
+		strconv.FormatInt(int64(movie.Version), 10),
+		movie.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+func (cw *csvMovieWriter) Flush() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+// ndjsonMovieWriter writes one movieRecord per line.
+type ndjsonMovieWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONMovieWriter(w io.Writer) *ndjsonMovieWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonMovieWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (nw *ndjsonMovieWriter) Write(movie *data.Movie) error {
+	return nw.enc.Encode(&movieRecord{
+		MovieRequest: data.MovieRequest{
+			ID:               movie.ID,
+			Title:            movie.Title,
+			OriginalLanguage: movie.OriginalLanguage,
+			Titles:           movie.Titles,
+			Year:             movie.Year,
+			Duration:         data.Duration(movie.Duration),
+			Genres:           movie.Genres,
+		},
+		Version:   movie.Version,
+		CreatedAt: movie.CreatedAt,
+	})
+}
+
+func (nw *ndjsonMovieWriter) Flush() error {
+	return nw.buf.Flush()
+}
+
+// sentWriter records whether any part of the response body has been passed to the client yet.
+type sentWriter struct {
+	http.ResponseWriter
+	sent bool
+}
+
+func (sw *sentWriter) Write(b []byte) (int, error) {
+	sw.sent = true
+	return sw.ResponseWriter.Write(b)
+}
+
+// exportMoviesHandler streams every movie matching the same filter and sort parameters as getMoviesHandler.
+// Rows are written as they are read from the database, so the response is never held in memory in full, and the
+// response may take as long as the query is given rather than the server's WriteTimeout. Both formats can be sent back
+// to POST /v1/movies/import.
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	filter, err := app.readMovieFilter(qs, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	format := app.readString(qs, "format", "ndjson")
+
+	filters := data.Filters{
+		Sort:         app.readString(qs, "sort", "id"),
+		SortSafelist: movieSortSafelist,
+	}
+
+	v.Check(validator.In(filters.Sort, filters.SortSafelist...), "sort", "invalid sort value")
+	v.Check(validator.In(format, "csv", "ndjson"), "format", "must be either csv or ndjson")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.extendWriteDeadline(r, data.ForEachTimeout)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	body := &sentWriter{ResponseWriter: w}
+
+	var rows movieRowWriter
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+
+		csvRows, err := newCSVMovieWriter(body)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		rows = csvRows
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+
+		rows = newNDJSONMovieWriter(body)
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies.%s"`, format))
+
+	// Push the buffered rows out to the client every so often, rather than after every row.
+	const flushEvery = 100
+
+	flusher, _ := w.(http.Flusher)
+	written := 0
+
+	err = app.models.Movies.ForEach(filter, filters, func(movie *data.Movie) error {
+		err := rows.Write(movie)
+		if err != nil {
+			return err
+		}
+
+		written++
+		if written%flushEvery != 0 {
+			return nil
+		}
+
+		err = rows.Flush()
+		if err == nil && flusher != nil {
+			flusher.Flush()
+		}
+		return err
+	})
+	if err != nil {
+		// Once the first rows have reached the client the status line has gone too, so the error can only be logged.
+		if body.sent {
+			app.logError(r, err)
+			return
+		}
+
+		w.Header().Del("Content-Disposition")
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = rows.Flush()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+)
+
+func TestExportMovies(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read")
+
+	// Enough movies for exportMoviesHandler to flush part of the export before the end.
+	const count = 250
+
+	for i := 1; i <= count; i++ {
+		movie := &data.Movie{Title: fmt.Sprintf("Movie %d", i), Year: 2000, Duration: 90, Genres: []string{"drama"}}
+
+		err := ts.app.models.Movies.Insert(movie)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		format       string
+		contentType  string
+		wantLines    int
+		wantDuration string
+	}{
+		// Durations are written as a number of minutes, as in the other movie responses.
+		{"ndjson", "application/x-ndjson", count, `"duration":90,`},
+		{"csv", "text/csv; charset=utf-8", count + 1, ",90,"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			testHandler.ServeHTTP(rr, newTestRequest(http.MethodGet, "/v1/movies/export?format="+tt.format, token, ""))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("got status %d; want %d: %s", rr.Code, http.StatusOK, rr.Body)
+			}
+
+			if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("got Content-Type %q; want %q", got, tt.contentType)
+			}
+
+			if !rr.Flushed {
+				t.Error("the export was never flushed")
+			}
+
+			body := rr.Body.String()
+
+			lines := 0
+			scanner := bufio.NewScanner(strings.NewReader(body))
+			for scanner.Scan() {
+				lines++
+			}
+
+			if lines != tt.wantLines {
+				t.Errorf("got %d lines; want %d", lines, tt.wantLines)
+			}
+
+			if !strings.Contains(body, tt.wantDuration) {
+				t.Errorf("got no duration written as %s in the export", tt.wantDuration)
+			}
+
+			if strings.Contains(body, `"error"`) {
+				t.Errorf("got an error in the export: %s", body)
+			}
+		})
+	}
+}
+
+func TestExtendWriteDeadline(t *testing.T) {
+	ts := newTestServer(t)
+
+	// A response which takes longer than the server's WriteTimeout.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := ts.app.extendWriteDeadline(r, time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Config.ConnContext = ts.app.contextSetConn
+	srv.Start()
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "done" {
+		t.Errorf("got body %q; want %q", body, "done")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// movieIncludeSafelist holds the related resources which can be embedded in movie responses with the include
+// parameter.
+var movieIncludeSafelist = []string{"credits", "ratings"}
+
+// movieRatings is the summary of the ratings of a movie embedded with include=ratings.
+type movieRatings struct {
+	Average float64 `json:"average"`
+	Count   int32   `json:"count"`
+}
+
+// movieShape holds the fields a movie response is narrowed down to and the related resources embedded in it. The
+// zero value leaves movies as they are.
+type movieShape struct {
+	Fields  []string
+	Include []string
+}
+
+// readMovieShape reads the fields and include query string parameters, and validates them.
+func (app *application) readMovieShape(qs url.Values, v *validator.Validator) movieShape {
+	shape := movieShape{
+		Fields:  app.readCSV(qs, "fields", []string{}),
+		Include: app.readCSV(qs, "include", []string{}),
+	}
+
+	for _, field := range shape.Fields {
+		v.Check(validator.In(field, data.MovieFields...), "fields", "invalid field value")
+	}
+	v.Check(validator.Unique(shape.Fields), "fields", "must not contain duplicate values")
+
+	for _, include := range shape.Include {
+		v.Check(validator.In(include, movieIncludeSafelist...), "include", "invalid include value")
+	}
+	v.Check(validator.Unique(shape.Include), "include", "must not contain duplicate values")
+
+	return shape
+}
+
+// columns returns the fields to read from the database, which are the requested fields along with any the embedded
+// resources are built from. It is empty, meaning every field, when no fields were requested.
+func (s movieShape) columns() []string {
+	if len(s.Fields) == 0 {
+		return nil
+	}
+
+	columns := append([]string(nil), s.Fields...)
+	if validator.In("ratings", s.Include...) {
+		columns = append(columns, "rating_average", "rating_count")
+	}
+
+	return columns
+}
+
+// movieEmbeds looks up the resources to embed in each of the movies, in the same order as the movies.
+func (app *application) movieEmbeds(movies []*data.Movie, shape movieShape) ([]map[string]interface{}, error) {
+	embeds := make([]map[string]interface{}, len(movies))
+	for i := range embeds {
+		embeds[i] = make(map[string]interface{}, len(shape.Include))
+	}
+
+	for _, include := range shape.Include {
+		switch include {
+		case "credits":
+			ids := make([]int64, len(movies))
+			for i, movie := range movies {
+				ids[i] = movie.ID
+			}
+
+			credits, err := app.models.Credits.GetAllForMovies(ids)
+			if err != nil {
+				return nil, err
+			}
+
+			for i, movie := range movies {
+				embeds[i]["credits"] = credits[movie.ID]
+			}
+		case "ratings":
+			for i, movie := range movies {
+				embeds[i]["ratings"] = movieRatings{Average: movie.RatingAverage, Count: movie.RatingCount}
+			}
+		}
+	}
+
+	return embeds, nil
+}
+
+// shape narrows a movie down to the requested fields, in their usual order, and appends the embedded resources in
+// the order they were requested. The movie is returned unchanged when there is nothing to do.
+func (s movieShape) shape(movie *data.Movie, embeds map[string]interface{}) (interface{}, error) {
+	if len(s.Fields) == 0 && len(s.Include) == 0 {
+		return movie, nil
+	}
+
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	var members map[string]json.RawMessage
+	err = json.Unmarshal(js, &members)
+	if err != nil {
+		return nil, err
+	}
+
+	object := jsonObject{}
+	for _, field := range data.MovieFields {
+		if len(s.Fields) == 0 || validator.In(field, s.Fields...) {
+			object = append(object, jsonMember{Key: field, Value: members[field]})
+		}
+	}
+	for _, include := range s.Include {
+		object = append(object, jsonMember{Key: include, Value: embeds[include]})
+	}
+
+	return object, nil
+}
+
+// etag extends the entity tag of a movie or a page of movies to cover the embedded resources, which can change
+// without the movies changing. The extended tag is weak, as it isn't derived from every byte of the response.
+func (s movieShape) etag(etag string, embeds []map[string]interface{}) (string, error) {
+	if len(s.Include) == 0 {
+		return etag, nil
+	}
+
+	js, err := json.Marshal(embeds)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s,%s", etag, js)
+
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16]), nil
+}
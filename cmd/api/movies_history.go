@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// recordRevision stores a revision of movie made by the user of the request. prior holds the state the movie had
+// before the change, or nil if it has just been inserted. It should be called with the same transaction as the change.
+func (app *application) recordRevision(models data.Models, r *http.Request, action string, prior, movie *data.Movie) error {
+	user := app.contextGetUser(r)
+
+	return models.Revisions.Insert(data.NewRevision(action, user.ID, prior, movie))
+}
+
+// getMovieHistoryHandler lists the revisions of a movie along with the fields each one changed.
+func (app *application) getMovieHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	// newest first by default
+	input.Filters.Sort = app.readString(qs, "sort", "-version")
+	input.Filters.SortSafelist = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the history stays readable while the movie is in the trash
+	_, err = app.models.Movies.GetIncludingDeleted(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.movieNotFoundResponse(w, r, id)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAllForMovie(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	type historyEntry struct {
+		Version    int32                       `json:"version"`
+		Action     string                      `json:"action"`
+		UserID     int64                       `json:"user_id,omitempty"`
+		CreatedAt  time.Time                   `json:"created_at"`
+		Changes    map[string]data.FieldChange `json:"changes"`
+		MergedFrom int64                       `json:"merged_from,omitempty"`
+	}
+
+	history := []historyEntry{}
+	for _, rev := range revisions {
+		history = append(history, historyEntry{
+			Version:    rev.Version,
+			Action:     rev.Action,
+			UserID:     rev.UserID,
+			CreatedAt:  rev.CreatedAt,
+			Changes:    rev.Changes(),
+			MergedFrom: rev.MergedFrom,
+		})
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"history": history, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertMovieHandler puts a movie's fields back to the values they had at an earlier version. The revert is saved
+// like any other update, so it creates a new version and fails if the movie is changed concurrently.
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	version := app.readInt(r.URL.Query(), "version", 0, v)
+	if v.Check(version > 0, "version", "must be provided as a positive integer"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.preconditionMet(r, movie) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	rev, err := app.models.Revisions.Get(id, int32(version))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("version", "no revision exists for this version")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	prior := *movie
+	rev.State.Apply(movie)
+
+	// the genres may have been renamed or merged since the revision
+	err = app.canonicalGenres(app.models, v, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateMovie(v, movie); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		err := tx.Movies.Update(movie)
+		if err != nil {
+			return err
+		}
+		return app.recordRevision(tx, r, data.RevisionRevert, &prior, movie)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.movieETag(r, movie, movieShape{}))
+
+	app.presentMovies(r, movie)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMovieHistory(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+	ts.do(http.MethodPatch, "/v1/movies/1", token, `{"title": "Vaiana"}`)
+	ts.do(http.MethodDelete, "/v1/movies/1", token, "")
+
+	// The history of a movie in the trash can still be read.
+	status, _, js := ts.do(http.MethodGet, "/v1/movies/1/history", token, "")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusOK, js)
+	}
+
+	history := js["history"].([]interface{})
+	if len(history) != 3 {
+		t.Fatalf("got %d revisions; want 3: %v", len(history), history)
+	}
+
+	if action := history[1].(map[string]interface{})["action"]; action != "update" {
+		t.Errorf("got action %v for version 2; want %q", action, "update")
+	}
+
+	// Only movies outside the trash can be reverted.
+	status, _, js = ts.do(http.MethodPost, "/v1/movies/1/revert?version=1", token, "")
+	if status != http.StatusNotFound {
+		t.Errorf("got status %d reverting a movie in the trash; want %d: %v", status, http.StatusNotFound, js)
+	}
+
+	status, _, js = ts.do(http.MethodGet, "/v1/movies/2/history", token, "")
+	if status != http.StatusNotFound {
+		t.Errorf("got status %d for a missing movie; want %d: %v", status, http.StatusNotFound, js)
+	}
+}
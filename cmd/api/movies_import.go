@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// genreSeparator separates the genres of a movie inside a single CSV field.
+const genreSeparator = "|"
+
+// movieCSVHeader lists the columns written by GET /v1/movies/export. All but id, version and created_at are read back
+// on import, with the translated titles as a JSON object in a single field.
+var movieCSVHeader = []string{"id", "title", "original_language", "titles", "year", "duration", "genres", "version", "created_at"}
+
+var (
+	errEmptyImport     = errors.New("request body must contain at least one movie")
+	errMalformedImport = errors.New("malformed import body")
+	errImportRejected  = errors.New("import rejected")
+)
+
+// movieRecord is a single line of the NDJSON movie format shared by the import and export endpoints. The id, version
+// and created_at fields are written by GET /v1/movies/export and ignored on import.
+type movieRecord struct {
+	data.MovieRequest
+	Version   int32     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// movieRowReader reads the movies of an import body one row at a time. Problems with the content of a row are
+// returned as field errors in the same shape that the validator produces, while err reports a problem with the
+// stream itself (and io.EOF once every row has been read).
+type movieRowReader interface {
+	Next() (movie *data.Movie, fieldErrors map[string]string, err error)
+}
+
+// ndjsonMovieReader reads newline-delimited JSON with one movieRecord per line. Blank lines are skipped.
+type ndjsonMovieReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONMovieReader(r io.Reader) *ndjsonMovieReader {
+	scanner := bufio.NewScanner(r)
+	// Allow each line to be as large as a request body accepted by readJSON().
+	scanner.Buffer(make([]byte, 0, 64*1024), 1_048_576)
+
+	return &ndjsonMovieReader{scanner: scanner}
+}
+
+func (nr *ndjsonMovieReader) Next() (*data.Movie, map[string]string, error) {
+	for nr.scanner.Scan() {
+		nr.line++
+
+		line := bytes.TrimSpace(nr.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record movieRecord
+
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&record)
+		if err == nil && dec.More() {
+			err = errors.New("each line must contain a single JSON value")
+		}
+		if err != nil {
+			if errors.Is(err, data.ErrInvalidDurationFormat) {
+				return nil, map[string]string{"duration": data.DurationFormatHelp}, nil
+			}
+			return nil, map[string]string{"row": triageJSONError(err).Error()}, nil
+		}
+
+		return &data.Movie{
+			Title:            record.Title,
+			OriginalLanguage: record.OriginalLanguage,
+			Titles:           record.Titles,
+			Year:             record.Year,
+			Duration:         int32(record.Duration),
+			Genres:           record.Genres,
+		}, nil, nil
+	}
+
+	if err := nr.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, nil, fmt.Errorf("line %d must not be larger than 1MB", nr.line+1)
+		}
+		return nil, nil, err
+	}
+
+	return nil, nil, io.EOF
+}
+
+// csvMovieReader reads CSV with a header row naming the title, year, duration and genres columns, and optionally the
+// original_language and titles columns. The duration is a whole number of minutes, the genres are separated by
+// genreSeparator and the titles are a JSON object of translations by language tag. Any other columns are ignored.
+type csvMovieReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVMovieReader(r io.Reader) (*csvMovieReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errEmptyImport
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range []string{"title", "year", "duration", "genres"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header must include the %q column", name)
+		}
+	}
+
+	return &csvMovieReader{reader: reader, columns: columns}, nil
+}
+
+func (cr *csvMovieReader) Next() (*data.Movie, map[string]string, error) {
+	record, err := cr.reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v := validator.New()
+
+	field := func(name string) string {
+		i := cr.columns[name]
+		if i >= len(record) {
+			v.AddError(name, "must be provided")
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	movie := &data.Movie{Title: field("title")}
+
+	if _, ok := cr.columns["original_language"]; ok {
+		movie.OriginalLanguage = field("original_language")
+	}
+
+	if _, ok := cr.columns["titles"]; ok {
+		if s := field("titles"); s != "" {
+			err := json.Unmarshal([]byte(s), &movie.Titles)
+			v.Check(err == nil, "titles", "must be a JSON object of titles by language tag")
+		}
+	}
+
+	if s := field("year"); s != "" {
+		year, err := strconv.ParseInt(s, 10, 32)
+		v.Check(err == nil, "year", "must be an integer value")
+		movie.Year = int32(year)
+	}
+
+	if s := field("duration"); s != "" {
+		duration, err := data.ParseDuration(s)
+		v.Check(err == nil, "duration", data.DurationFormatHelp)
+		movie.Duration = int32(duration)
+	}
+
+	if s := field("genres"); s != "" {
+		for _, genre := range strings.Split(s, genreSeparator) {
+			if genre = strings.TrimSpace(genre); genre != "" {
+				movie.Genres = append(movie.Genres, genre)
+			}
+		}
+	}
+
+	if !v.Valid() {
+		return nil, v.Errors, nil
+	}
+
+	return movie, nil, nil
+}
+
+type movieImportRow struct {
+	Row    int               `json:"row"`
+	ID     int64             `json:"id,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type movieImportReport struct {
+	Mode    string           `json:"mode"`
+	Created int              `json:"created"`
+	Failed  int              `json:"failed"`
+	Rows    []movieImportRow `json:"rows"`
+}
+
+// importTimeout is how long an import may take to upload its body and have it inserted, in place of the server's
+// ReadTimeout and WriteTimeout.
+const importTimeout = 5 * time.Minute
+
+// importMoviesHandler creates movies from a streamed NDJSON or CSV body. In the default "transaction" mode a single
+// invalid row rejects the whole batch, while in "row" mode every valid row is inserted on its own. A row whose movie
+// has likely duplicates fails, as it would on POST /v1/movies, unless allow_duplicate is set. The whole body is read and
+// checked before anything is inserted, so that no transaction stays open while the client uploads it.
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	mode := app.readString(qs, "mode", "transaction")
+	allowDuplicate := app.readBool(qs, "allow_duplicate", false, v)
+
+	if v.Check(validator.In(mode, "transaction", "row"), "mode", "must be either transaction or row"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.extendReadDeadline(r, importTimeout)
+	if err == nil {
+		err = app.extendWriteDeadline(r, importTimeout)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The body is streamed a row at a time, so it may be far larger than readJSON() allows.
+	maxBytes := 104_857_600
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var rows movieRowReader
+
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl":
+		rows = newNDJSONMovieReader(r.Body)
+	case "text/csv":
+		csvRows, err := newCSVMovieReader(r.Body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		rows = csvRows
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	report := movieImportReport{Mode: mode, Rows: []movieImportRow{}}
+
+	// validRow is a row which passed its checks, with its place in report.Rows.
+	type validRow struct {
+		index int
+		movie *data.Movie
+	}
+
+	valid := []validRow{}
+
+	for n := 1; ; n++ {
+		movie, fieldErrors, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("%w: %v", errMalformedImport, err))
+			return
+		}
+
+		if fieldErrors == nil {
+			v := validator.New()
+
+			err = app.canonicalGenres(app.models, v, movie)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if data.ValidateMovie(v, movie); !v.Valid() {
+				fieldErrors = v.Errors
+			}
+		}
+
+		report.Rows = append(report.Rows, movieImportRow{Row: n, Errors: fieldErrors})
+
+		if fieldErrors != nil {
+			report.Failed++
+			continue
+		}
+
+		valid = append(valid, validRow{index: len(report.Rows) - 1, movie: movie})
+	}
+
+	if len(report.Rows) == 0 {
+		app.badRequestResponse(w, r, errEmptyImport)
+		return
+	}
+
+	// insertRow inserts the movie of a row, or fails the row if the movie has likely duplicates.
+	insertRow := func(tx data.Models, row validRow) error {
+		duplicates, err := app.insertMovie(tx, r, row.movie, allowDuplicate)
+		if err != nil {
+			return err
+		}
+
+		if len(duplicates) > 0 {
+			report.Failed++
+			report.Rows[row.index].Errors = map[string]string{
+				"title": fmt.Sprintf("a movie with the same title and year already exists (%d), pass allow_duplicate=true to import it anyway", duplicates[0].ID),
+			}
+			return nil
+		}
+
+		report.Created++
+		report.Rows[row.index].ID = row.movie.ID
+		return nil
+	}
+
+	switch {
+	case mode == "transaction" && report.Failed > 0:
+		err = errImportRejected
+	case mode == "transaction":
+		// The rows after a duplicate are still inserted, only for the transaction to roll back, so that every
+		// duplicate is reported, including those of earlier rows.
+		err = app.models.Atomic(func(tx data.Models) error {
+			for _, row := range valid {
+				err := insertRow(tx, row)
+				if err != nil {
+					return err
+				}
+			}
+
+			if report.Failed > 0 {
+				return errImportRejected
+			}
+			return nil
+		})
+	default:
+		// In row mode each movie is inserted along with its revision in a transaction of its own.
+		for _, row := range valid {
+			err = app.models.Atomic(func(tx data.Models) error {
+				return insertRow(tx, row)
+			})
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	switch {
+	case err == nil:
+		status := http.StatusCreated
+		if report.Failed > 0 {
+			status = http.StatusOK
+		}
+
+		err = app.writeResponse(w, r, status, envelope{"import": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	case errors.Is(err, errImportRejected):
+		// Nothing was written, so drop the ids of the rows which were inserted before the transaction rolled back.
+		report.Created = 0
+		for i := range report.Rows {
+			report.Rows[i].ID = 0
+		}
+
+		err = app.writeResponse(w, r, http.StatusUnprocessableEntity, envelope{"import": report}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+)
+
+// importMovies posts an import body and returns the status and the import report.
+func (ts *testServer) importMovies(token, query, contentType, body string) (int, map[string]interface{}) {
+	ts.t.Helper()
+
+	r := newTestRequest(http.MethodPost, "/v1/movies/import"+query, token, body)
+	r.Header.Set("Content-Type", contentType)
+
+	status, _, js := ts.send(r)
+
+	report, _ := js["import"].(map[string]interface{})
+	if report == nil {
+		report = js
+	}
+
+	return status, report
+}
+
+// countMovies returns how many movies are stored outside the trash.
+func (ts *testServer) countMovies() int {
+	ts.t.Helper()
+
+	_, metadata, err := ts.app.models.Movies.GetAll(data.MovieFilter{}, data.Filters{Page: 1, PageSize: 100, Sort: "id", SortSafelist: []string{"id"}})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	return metadata.TotalRecords
+}
+
+func TestImportMovies(t *testing.T) {
+	const (
+		ndjson = "application/x-ndjson"
+		csv    = "text/csv"
+	)
+
+	valid := `{"title": "Moana", "year": 2016, "duration": "107 mins", "genres": ["animation"]}
+{"title": "Up", "year": 2009, "duration": "96 mins", "genres": ["animation"]}
+`
+	invalid := `{"title": "Moana", "year": 2016, "duration": "107 mins", "genres": ["animation"]}
+{"title": "", "year": 2009, "duration": "96 mins", "genres": ["animation"]}
+`
+	repeated := `{"title": "Moana", "year": 2016, "duration": "107 mins", "genres": ["animation"]}
+{"title": "MOANA", "year": 2016, "duration": "107 mins", "genres": ["animation"]}
+`
+
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCreated float64
+		wantFailed  float64
+		wantStored  int
+	}{
+		{"Transaction", "", ndjson, valid, http.StatusCreated, 2, 0, 2},
+		{"Transaction with an invalid row", "", ndjson, invalid, http.StatusUnprocessableEntity, 0, 1, 0},
+		{"Row mode with an invalid row", "?mode=row", ndjson, invalid, http.StatusOK, 1, 1, 1},
+		{"CSV", "", csv, "title,year,duration,genres\nMoana,2016,107,animation|adventure\n", http.StatusCreated, 1, 0, 1},
+		{"Duplicate rows", "", ndjson, repeated, http.StatusUnprocessableEntity, 0, 1, 0},
+		{"Duplicate rows in row mode", "?mode=row", ndjson, repeated, http.StatusOK, 1, 1, 1},
+		{"Duplicate rows allowed", "?allow_duplicate=true", ndjson, repeated, http.StatusCreated, 2, 0, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+			status, report := ts.importMovies(token, tt.query, tt.contentType, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, report)
+			}
+
+			if report["created"] != tt.wantCreated || report["failed"] != tt.wantFailed {
+				t.Errorf("got created %v and failed %v; want %v and %v", report["created"], report["failed"], tt.wantCreated, tt.wantFailed)
+			}
+
+			if stored := ts.countMovies(); stored != tt.wantStored {
+				t.Errorf("got %d movies stored; want %d", stored, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestImportMoviesDuplicatesStored(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+
+	body := `{"title": "Up", "year": 2009, "duration": "96 mins", "genres": ["animation"]}
+{"title": "The Moana", "year": 2016, "duration": "107 mins", "genres": ["animation"]}
+`
+
+	status, report := ts.importMovies(token, "", "application/x-ndjson", body)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusUnprocessableEntity, report)
+	}
+
+	rows := report["rows"].([]interface{})
+	errs, _ := rows[1].(map[string]interface{})["errors"].(map[string]interface{})
+	if !strings.Contains(errs["title"].(string), "already exists (1)") {
+		t.Errorf("got errors %v for the duplicate row", errs)
+	}
+
+	if stored := ts.countMovies(); stored != 1 {
+		t.Errorf("got %d movies stored; want 1", stored)
+	}
+}
+
+func TestImportMoviesMalformed(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	// The bare quote on the third line breaks the CSV, so even in row mode nothing is imported.
+	body := "title,year,duration,genres\nMoana,2016,107,animation\nUp\",2009,96,animation\n"
+
+	status, report := ts.importMovies(token, "?mode=row", "text/csv", body)
+	if status != http.StatusBadRequest {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusBadRequest, report)
+	}
+
+	if stored := ts.countMovies(); stored != 0 {
+		t.Errorf("got %d movies stored; want 0", stored)
+	}
+}
+
+func TestExtendReadDeadline(t *testing.T) {
+	ts := newTestServer(t)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := ts.app.extendReadDeadline(r, time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Write(body)
+	}))
+	srv.Config.ReadTimeout = 50 * time.Millisecond
+	srv.Config.ConnContext = ts.app.contextSetConn
+	srv.Start()
+	defer srv.Close()
+
+	// A body which takes longer to arrive than the server's ReadTimeout.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("first "))
+		time.Sleep(200 * time.Millisecond)
+		pw.Write([]byte("second"))
+		pw.Close()
+	}()
+
+	res, err := srv.Client().Post(srv.URL, "text/plain", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "first second" {
+		t.Errorf("got body %q; want %q", body, "first second")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// insertMovie adds a movie along with its revision, unless allowDuplicate is false and the movie has likely duplicates,
+// which are returned instead. It must be called inside Models.Atomic(), so that the lock FindDuplicates() takes keeps
+// another request from adding the same film until the movie is committed.
+func (app *application) insertMovie(tx data.Models, r *http.Request, movie *data.Movie, allowDuplicate bool) ([]*data.Movie, error) {
+	if !allowDuplicate {
+		duplicates, err := tx.Movies.FindDuplicates(movie.Title, movie.Year)
+		if err != nil {
+			return nil, err
+		}
+		if len(duplicates) > 0 {
+			return duplicates, nil
+		}
+	}
+
+	err := tx.Movies.Insert(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, app.recordRevision(tx, r, data.RevisionInsert, nil, movie)
+}
+
+// duplicateMovieResponse answers the creation of a movie which looks like one already stored with 409 Conflict,
+// listing the likely duplicates.
+func (app *application) duplicateMovieResponse(w http.ResponseWriter, r *http.Request, duplicates []*data.Movie) {
+	app.presentMovies(r, duplicates...)
+
+	env := envelope{
+		"error":      "a movie with the same title and year already exists, pass allow_duplicate=true to create it anyway",
+		"duplicates": duplicates,
+	}
+
+	err := app.writeResponse(w, r, http.StatusConflict, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// movieNotFoundResponse answers a read of a movie which doesn't exist. If the movie was merged into another one, the
+// client is sent to the same path under that movie's id instead.
+func (app *application) movieNotFoundResponse(w http.ResponseWriter, r *http.Request, id int64) {
+	targetID, err := app.models.Movies.Redirect(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	location := fmt.Sprintf("/v1/movies/%d%s", targetID, strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/v1/movies/%d", id)))
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", location)
+
+	err = app.writeResponse(w, r, http.StatusMovedPermanently, envelope{"message": fmt.Sprintf("the movie was merged into movie %d", targetID)}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeMovieHandler folds a duplicate movie into another, given by the "into" field, and deletes it. Its ratings,
+// credits, watchlist items and history move to the other movie, and its id redirects there from then on.
+func (app *application) mergeMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Into int64 `json:"into"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Into > 0, "into", "must be provided")
+	v.Check(input.Into != id, "into", "must not be the movie being merged")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	source, err := app.models.Movies.Get(id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !app.preconditionMet(r, source) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	target, err := app.models.Movies.Get(input.Into)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("into", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	prior := *target
+
+	var dropped []*data.Image
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		var err error
+		dropped, err = tx.Movies.Merge(source, target)
+		if err != nil {
+			return err
+		}
+		return app.recordRevision(tx, r, data.RevisionMerge, &prior, target)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			app.editConflictResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, image := range dropped {
+		app.deleteBlobs(image.Keys()...)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", target.ID))
+	headers.Set("ETag", app.movieETag(r, target, movieShape{}))
+
+	app.presentMovies(r, target)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": target}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
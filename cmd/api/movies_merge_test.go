@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/lorezi/duxfilm/internal/data"
+)
+
+func TestMergeMovie(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+	ts.newUser("bob@example.com", true, "movies:read")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+	ts.do(http.MethodPost, "/v1/movies", token, `{"title": "Vaiana", "year": 2016, "duration": 107, "genres": ["animation"]}`)
+	ts.do(http.MethodPatch, "/v1/movies/1", token, `{"duration": 108}`)
+
+	const source, target = 1, 2
+
+	models := ts.app.models
+
+	alice, err := models.User.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := models.User.GetByEmail("bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice rated and listed both movies, Bob only the one being merged away.
+	for _, rating := range []*data.Rating{
+		{UserID: alice.ID, MovieID: source, Score: 2},
+		{UserID: alice.ID, MovieID: target, Score: 4},
+		{UserID: bob.ID, MovieID: source, Score: 5},
+	} {
+		err := models.Ratings.Set(rating)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, item := range []*data.WatchlistItem{
+		{UserID: alice.ID, MovieID: source},
+		{UserID: alice.ID, MovieID: target},
+		{UserID: bob.ID, MovieID: source},
+	} {
+		err := models.Watchlist.Add(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	person := &data.Person{Name: "Ron Clements"}
+	err = models.People.Insert(person)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Credits.ReplaceForMovie(source, []*data.Credit{{PersonID: person.ID, Role: data.RoleDirector, BillingOrder: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection := &data.Collection{Name: "Disney", MovieIDs: []int64{source}}
+	err = models.Collections.Insert(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, header, js := ts.do(http.MethodPost, "/v1/movies/1/merge", token, `{"into": 2}`)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusOK, js)
+	}
+
+	if got := header.Get("Location"); got != "/v1/movies/2" {
+		t.Errorf("got Location %q; want %q", got, "/v1/movies/2")
+	}
+
+	movie := js["movie"].(map[string]interface{})
+	if movie["id"] != float64(target) || movie["rating_count"] != float64(2) {
+		t.Errorf("got movie %v; want movie %d with 2 ratings", movie, target)
+	}
+
+	// Where a user rated both movies, their rating of the target is kept.
+	for _, tt := range []struct {
+		userID    int64
+		wantScore int32
+	}{
+		{alice.ID, 4},
+		{bob.ID, 5},
+	} {
+		rating, err := models.Ratings.Get(tt.userID, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rating.Score != tt.wantScore {
+			t.Errorf("got score %d from user %d; want %d", rating.Score, tt.userID, tt.wantScore)
+		}
+	}
+
+	for _, tt := range []struct {
+		userID int64
+		want   []int64
+	}{
+		{alice.ID, []int64{target}},
+		{bob.ID, []int64{target}},
+	} {
+		items, _, err := models.Watchlist.GetAllForUser(tt.userID, nil, data.Filters{Page: 1, PageSize: 20, Sort: "position", SortSafelist: []string{"position"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []int64{}
+		for _, item := range items {
+			ids = append(ids, item.MovieID)
+		}
+
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("got watchlist %v for user %d; want %v", ids, tt.userID, tt.want)
+		}
+	}
+
+	credits, err := models.Credits.GetAllForMovie(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(credits) != 1 || credits[0].PersonID != person.ID {
+		t.Errorf("got credits %+v; want the director of the merged movie", credits)
+	}
+
+	collection, err = models.Collections.Get(collection.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int64{target}; !reflect.DeepEqual(collection.MovieIDs, want) {
+		t.Errorf("got collection movies %v; want %v", collection.MovieIDs, want)
+	}
+
+	// The merged movie's history carries on under the target.
+	_, _, js = ts.do(http.MethodGet, "/v1/movies/2/history?sort=version", token, "")
+
+	mergedFrom := 0
+	for _, entry := range js["history"].([]interface{}) {
+		if entry.(map[string]interface{})["merged_from"] == float64(source) {
+			mergedFrom++
+		}
+	}
+
+	if mergedFrom != 2 {
+		t.Errorf("got %d revisions merged from movie %d; want 2: %v", mergedFrom, source, js["history"])
+	}
+
+	// The merged movie's id leads to the target.
+	status, header, _ = ts.do(http.MethodGet, "/v1/movies/1", token, "")
+	if status != http.StatusMovedPermanently || header.Get("Location") != "/v1/movies/2" {
+		t.Errorf("got status %d and Location %q for the merged movie", status, header.Get("Location"))
+	}
+}
+
+func TestMergeMovieValidation(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+
+	tests := []struct {
+		name       string
+		url        string
+		body       string
+		wantStatus int
+	}{
+		{"Into itself", "/v1/movies/1/merge", `{"into": 1}`, http.StatusUnprocessableEntity},
+		{"Missing target", "/v1/movies/1/merge", `{"into": 2}`, http.StatusUnprocessableEntity},
+		{"No target", "/v1/movies/1/merge", `{}`, http.StatusUnprocessableEntity},
+		{"Missing source", "/v1/movies/2/merge", `{"into": 1}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(http.MethodPost, tt.url, token, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// The media types of the patch documents accepted by updateMovieHandler, besides a plain JSON object of the fields to
+// change.
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+)
+
+// movieEditableFields lists the members of a movie's JSON document which a patch may change. The others may be read
+// by test operations, e.g. to check the version, but must be left as they are.
+var movieEditableFields = []string{"title", "original_language", "titles", "year", "duration", "genres"}
+
+// errPatchTestFailed is returned when a test operation of a JSON Patch doesn't hold.
+var errPatchTestFailed = errors.New("a test operation failed")
+
+// patchOperation is one operation of a JSON Patch (RFC 6902). Value is empty when the member is missing, so that it
+// can be told apart from null.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchMovie applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) in the request body to the JSON document
+// of the movie, and copies the editable fields of the result back into the movie. Failures are reported in v, except
+// for a patch document which can't be read, which is returned, and a failed test operation, reported with
+// errPatchTestFailed.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, mediaType string, movie *data.Movie, v *validator.Validator) error {
+	doc, err := movieDocument(movie)
+	if err != nil {
+		return err
+	}
+
+	original := copyJSONValue(doc).(map[string]interface{})
+
+	switch mediaType {
+	case mergePatchMediaType:
+		var patch interface{}
+
+		err = app.readJSON(w, r, &patch)
+		if err != nil {
+			return err
+		}
+
+		doc = applyMergePatch(doc, patch)
+	case jsonPatchMediaType:
+		var raw []json.RawMessage
+
+		err = app.readJSON(w, r, &raw)
+		if err != nil {
+			return err
+		}
+
+		for i, js := range raw {
+			key := fmt.Sprintf("patch[%d]", i)
+
+			var op patchOperation
+			if json.Unmarshal(js, &op) != nil {
+				v.AddError(key, "must be an object with op and path members")
+				return nil
+			}
+
+			doc, err = applyPatchOperation(doc, op)
+			if err != nil {
+				if errors.Is(err, errPatchTestFailed) {
+					return fmt.Errorf("%w: %s on %q", errPatchTestFailed, key, op.Path)
+				}
+				v.AddError(key, err.Error())
+				return nil
+			}
+		}
+	}
+
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		v.AddError("patch", "must leave the movie as a JSON object")
+		return nil
+	}
+
+	// Everything but the editable fields must be left alone.
+	for key, value := range original {
+		if !validator.In(key, movieEditableFields...) && !reflect.DeepEqual(object[key], value) {
+			v.AddError(key, "cannot be changed")
+		}
+	}
+	for key := range object {
+		if _, ok := original[key]; !ok {
+			v.AddError(key, "is not a field of a movie")
+		}
+	}
+
+	if !v.Valid() {
+		return nil
+	}
+
+	// Removed fields are left empty, so that ValidateMovie() reports them as missing.
+	var duration data.Duration
+
+	targets := map[string]interface{}{
+		"title":             &movie.Title,
+		"original_language": &movie.OriginalLanguage,
+		"titles":            &movie.Titles,
+		"year":              &movie.Year,
+		"duration":          &duration,
+		"genres":            &movie.Genres,
+	}
+
+	movie.Title, movie.OriginalLanguage, movie.Titles, movie.Year, movie.Genres = "", "", nil, 0, nil
+
+	for _, field := range movieEditableFields {
+		value, ok := object[field]
+		if !ok {
+			continue
+		}
+
+		js, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(js, targets[field])
+		if err != nil {
+			if errors.Is(err, data.ErrInvalidDurationFormat) {
+				v.AddError(field, data.DurationFormatHelp)
+			} else {
+				v.AddError(field, "has the wrong JSON type")
+			}
+		}
+	}
+
+	movie.Duration = int32(duration)
+
+	return nil
+}
+
+// movieDocument returns the JSON document of a movie as a tree of maps, slices and plain values, with the duration
+// in minutes.
+func movieDocument(movie *data.Movie) (interface{}, error) {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	err = json.Unmarshal(js, &doc)
+	return doc, err
+}
+
+// applyMergePatch applies a JSON Merge Patch to a document, as described in RFC 7396: members of the patch replace
+// those of the document, objects are merged recursively and null removes a member.
+func applyMergePatch(doc, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	docObject, ok := doc.(map[string]interface{})
+	if !ok {
+		docObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(docObject, key)
+			continue
+		}
+		docObject[key] = applyMergePatch(docObject[key], value)
+	}
+
+	return docObject
+}
+
+// applyPatchOperation applies one operation of a JSON Patch to a document, and returns the new document. The
+// document may be modified in place.
+func applyPatchOperation(doc interface{}, op patchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, fmt.Errorf("path %s", err)
+	}
+
+	var value interface{}
+	if validator.In(op.Op, "add", "replace", "test") {
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("must have a value for a %s operation", op.Op)
+		}
+		err = json.Unmarshal(op.Value, &value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var from []string
+	if validator.In(op.Op, "move", "copy") {
+		from, err = parseJSONPointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("from %s", err)
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return addJSONValue(doc, path, value)
+	case "remove":
+		doc, _, err = removeJSONValue(doc, path)
+		return doc, err
+	case "replace":
+		doc, _, err = removeJSONValue(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return addJSONValue(doc, path, value)
+	case "move":
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, errors.New("must not move a value into itself")
+		}
+
+		doc, moved, err := removeJSONValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addJSONValue(doc, path, moved)
+	case "copy":
+		copied, err := getJSONValue(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addJSONValue(doc, path, copyJSONValue(copied))
+	case "test":
+		current, err := getJSONValue(doc, path)
+		if err != nil || !reflect.DeepEqual(current, value) {
+			return nil, errPatchTestFailed
+		}
+		return doc, nil
+	}
+
+	return nil, errors.New("must have an op of add, remove, replace, move, copy or test")
+}
+
+// parseJSONPointer splits a JSON Pointer (RFC 6901), such as "/genres/0", into its reference tokens.
+func parseJSONPointer(s string) ([]string, error) {
+	if s == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(s, "/") {
+		return nil, errors.New("must be a JSON Pointer starting with /")
+	}
+
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex reads the reference token of an array element. With end set, "-" refers to the position after the last
+// element, and so does an index equal to the length of the array.
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%q is not an array index", token)
+	}
+
+	if i > length || (i == length && !end) {
+		return 0, fmt.Errorf("index %d is out of range", i)
+	}
+
+	return i, nil
+}
+
+func getJSONValue(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch container := doc.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = container[i]
+		default:
+			return nil, fmt.Errorf("%q refers into a value which is not an object or array", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// addJSONValue adds a member to an object, inserts an element into an array or, for the root, replaces the document.
+func addJSONValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := getJSONValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[token] = value
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(container), true)
+		if err != nil {
+			return nil, err
+		}
+
+		container = append(container, nil)
+		copy(container[i+1:], container[i:])
+		container[i] = value
+
+		// The array may have moved, so store it back in its parent.
+		return setJSONValue(doc, path[:len(path)-1], container)
+	}
+
+	return nil, fmt.Errorf("%q refers into a value which is not an object or array", token)
+}
+
+// removeJSONValue removes a member of an object or an element of an array, and returns the new document and the
+// value which was removed.
+func removeJSONValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("must not refer to the whole movie")
+	}
+
+	removed, err := getJSONValue(doc, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parent, _ := getJSONValue(doc, path[:len(path)-1])
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		delete(container, token)
+		return doc, removed, nil
+	case []interface{}:
+		i, _ := arrayIndex(token, len(container), false)
+		container = append(container[:i:i], container[i+1:]...)
+
+		doc, err = setJSONValue(doc, path[:len(path)-1], container)
+		return doc, removed, err
+	}
+
+	return doc, removed, nil
+}
+
+// setJSONValue replaces the value at an existing path.
+func setJSONValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := getJSONValue(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	token := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[token] = value
+	case []interface{}:
+		i, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = value
+	}
+
+	return doc, nil
+}
+
+// copyJSONValue returns a deep copy of a value, so that later operations on the copy leave the original alone.
+func copyJSONValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			c[k] = copyJSONValue(v)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(value))
+		for i, v := range value {
+			c[i] = copyJSONValue(v)
+		}
+		return c
+	}
+
+	return value
+}
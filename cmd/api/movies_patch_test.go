@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/lorezi/duxfilm/internal/data"
+)
+
+func TestParseJSONPointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{}, false},
+		{"/", []string{""}, false},
+		{"/genres/0", []string{"genres", "0"}, false},
+		{"/titles/a~1b", []string{"titles", "a/b"}, false},
+		{"/titles/a~0b", []string{"titles", "a~b"}, false},
+		// ~01 is ~1 escaped, not a slash.
+		{"/titles/~01", []string{"titles", "~1"}, false},
+		{"genres", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pointer, func(t *testing.T) {
+			got, err := parseJSONPointer(tt.pointer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want an error %t", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got tokens %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateMovieJSONPatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		patch      string
+		wantStatus int
+		wantField  string
+		wantValue  interface{}
+	}{
+		{"Replace", `[{"op": "replace", "path": "/title", "value": "Vaiana"}]`, http.StatusOK, "title", "Vaiana"},
+		{"Append", `[{"op": "add", "path": "/genres/-", "value": "comedy"}]`, http.StatusOK, "genres", []interface{}{"animation", "adventure", "comedy"}},
+		{"Insert", `[{"op": "add", "path": "/genres/0", "value": "comedy"}]`, http.StatusOK, "genres", []interface{}{"comedy", "animation", "adventure"}},
+		{"Remove", `[{"op": "remove", "path": "/genres/1"}]`, http.StatusOK, "genres", []interface{}{"animation"}},
+		{"Move", `[{"op": "move", "from": "/genres/0", "path": "/genres/1"}]`, http.StatusOK, "genres", []interface{}{"adventure", "animation"}},
+		{"Add a translation", `[{"op": "add", "path": "/titles/fr", "value": "Vaiana"}]`, http.StatusOK, "titles", map[string]interface{}{"fr": "Vaiana"}},
+		{"Test and replace", `[{"op": "test", "path": "/version", "value": 1}, {"op": "replace", "path": "/year", "value": 2017}]`, http.StatusOK, "year", float64(2017)},
+		{"Failed test", `[{"op": "test", "path": "/version", "value": 2}, {"op": "replace", "path": "/year", "value": 2017}]`, http.StatusConflict, "", nil},
+		{"Index out of range", `[{"op": "remove", "path": "/genres/2"}]`, http.StatusUnprocessableEntity, "patch[0]", nil},
+		{"Index with a leading zero", `[{"op": "remove", "path": "/genres/01"}]`, http.StatusUnprocessableEntity, "patch[0]", nil},
+		{"Pointer without a slash", `[{"op": "remove", "path": "genres"}]`, http.StatusUnprocessableEntity, "patch[0]", nil},
+		{"Missing member", `[{"op": "remove", "path": "/rating"}]`, http.StatusUnprocessableEntity, "patch[0]", nil},
+		{"Move into itself", `[{"op": "move", "from": "/genres", "path": "/genres/0"}]`, http.StatusUnprocessableEntity, "patch[0]", nil},
+		{"Read-only field", `[{"op": "replace", "path": "/id", "value": 2}]`, http.StatusUnprocessableEntity, "id", nil},
+		{"Unknown field", `[{"op": "add", "path": "/rating", "value": "PG"}]`, http.StatusUnprocessableEntity, "rating", nil},
+		{"Removed title", `[{"op": "remove", "path": "/title"}]`, http.StatusUnprocessableEntity, "title", nil},
+		{"Unknown op", `[{"op": "append", "path": "/genres"}]`, http.StatusUnprocessableEntity, "patch[0]", nil},
+	}
+
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every patch is applied to a movie of its own.
+			movie := &data.Movie{Title: "Moana", Year: 2016, Duration: 107, Genres: []string{"animation", "adventure"}}
+
+			err := ts.app.models.Movies.Insert(movie)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			url := fmt.Sprintf("/v1/movies/%d", movie.ID)
+
+			r := newTestRequest(http.MethodPatch, url, token, tt.patch)
+			r.Header.Set("Content-Type", jsonPatchMediaType)
+
+			status, _, js := ts.send(r)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			switch status {
+			case http.StatusOK:
+				patched := js["movie"].(map[string]interface{})
+				if !reflect.DeepEqual(patched[tt.wantField], tt.wantValue) {
+					t.Errorf("got %s %v; want %v", tt.wantField, patched[tt.wantField], tt.wantValue)
+				}
+			case http.StatusUnprocessableEntity:
+				if errs, _ := js["error"].(map[string]interface{}); errs[tt.wantField] == nil {
+					t.Errorf("got error %v; want one for %s", js["error"], tt.wantField)
+				}
+			}
+
+			// A patch is applied in full or not at all.
+			if status != http.StatusOK {
+				_, _, js = ts.do(http.MethodGet, url, token, "")
+				if version := js["movie"].(map[string]interface{})["version"]; version != float64(1) {
+					t.Errorf("got version %v after a failed patch; want 1", version)
+				}
+			}
+		})
+	}
+}
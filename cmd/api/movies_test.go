@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/lorezi/duxfilm/internal/data"
+)
+
+const testMovie = `{"title": "Moana", "year": 2016, "duration": "107 mins", "genres": ["animation", "adventure"]}`
+
+func TestCreateMovie(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+	reader := ts.newUser("bob@example.com", true, "movies:read")
+
+	tests := []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"Valid", token, testMovie, http.StatusCreated},
+		{"Missing title", token, `{"year": 2016, "duration": "107 mins", "genres": ["animation"]}`, http.StatusUnprocessableEntity},
+		{"Future year", token, `{"title": "Moana", "year": 3000, "duration": "107 mins", "genres": ["animation"]}`, http.StatusUnprocessableEntity},
+		{"Bad duration", token, `{"title": "Moana", "year": 2016, "duration": "long", "genres": ["animation"]}`, http.StatusUnprocessableEntity},
+		{"Unknown field", token, `{"title": "Moana", "rating": "PG"}`, http.StatusBadRequest},
+		{"No permission", reader, testMovie, http.StatusForbidden},
+		{"Anonymous", "", testMovie, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, js := ts.do(http.MethodPost, "/v1/movies", tt.token, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			if status != http.StatusCreated {
+				return
+			}
+
+			movie := js["movie"].(map[string]interface{})
+			if movie["title"] != "Moana" || movie["version"] != float64(1) {
+				t.Errorf("got movie %v", movie)
+			}
+
+			if got := header.Get("Location"); got != "/v1/movies/1" {
+				t.Errorf("got Location %q; want %q", got, "/v1/movies/1")
+			}
+		})
+	}
+}
+
+func TestCreateMovieDuplicates(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	// Editors adding the same film at the same moment: only one of them may create it.
+	const editors = 10
+
+	statuses := make(chan int, editors)
+
+	var wg sync.WaitGroup
+	for i := 0; i < editors; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, _, _ := ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+			statuses <- status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != editors-1 {
+		t.Fatalf("got statuses %v; want one %d and the rest %d", counts, http.StatusCreated, http.StatusConflict)
+	}
+
+	// The title is compared once normalised.
+	status, _, js := ts.do(http.MethodPost, "/v1/movies", token, `{"title": "moana!", "year": 2016, "duration": "107 mins", "genres": ["animation"]}`)
+	if status != http.StatusConflict {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusConflict, js)
+	}
+
+	if duplicates, _ := js["duplicates"].([]interface{}); len(duplicates) != 1 {
+		t.Errorf("got duplicates %v; want the one movie", js["duplicates"])
+	}
+
+	status, _, js = ts.do(http.MethodPost, "/v1/movies?allow_duplicate=true", token, testMovie)
+	if status != http.StatusCreated {
+		t.Errorf("got status %d with allow_duplicate; want %d: %v", status, http.StatusCreated, js)
+	}
+}
+
+func TestShowMovie(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{"Valid ID", "/v1/movies/1", http.StatusOK},
+		{"Non-existent ID", "/v1/movies/2", http.StatusNotFound},
+		{"Negative ID", "/v1/movies/-1", http.StatusNotFound},
+		{"String ID", "/v1/movies/foo", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, js := ts.do(http.MethodGet, tt.url, token, "")
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			if status == http.StatusOK && header.Get("ETag") == "" {
+				t.Error("missing ETag header")
+			}
+		})
+	}
+}
+
+func TestUpdateMovie(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+
+	status, _, js := ts.do(http.MethodPatch, "/v1/movies/1", token, `{"title": "Vaiana", "year": 2017}`)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusOK, js)
+	}
+
+	movie := js["movie"].(map[string]interface{})
+	if movie["title"] != "Vaiana" || movie["year"] != float64(2017) || movie["version"] != float64(2) {
+		t.Errorf("got movie %v", movie)
+	}
+
+	// Fields left out of the request keep their values.
+	if movie["duration"] != float64(107) {
+		t.Errorf("got duration %v; want 107", movie["duration"])
+	}
+
+	status, _, js = ts.do(http.MethodPatch, "/v1/movies/1", token, `{"title": ""}`)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for an empty title; want %d: %v", status, http.StatusUnprocessableEntity, js)
+	}
+
+	status, _, js = ts.do(http.MethodPatch, "/v1/movies/2", token, `{"title": "Vaiana"}`)
+	if status != http.StatusNotFound {
+		t.Errorf("got status %d for a missing movie; want %d: %v", status, http.StatusNotFound, js)
+	}
+}
+
+func TestUpdateMovieConflict(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+
+	_, header, _ := ts.do(http.MethodGet, "/v1/movies/1", token, "")
+	etag := header.Get("ETag")
+
+	update := func(title string) int {
+		r := newTestRequest(http.MethodPatch, "/v1/movies/1", token, `{"title": "`+title+`"}`)
+		r.Header.Set("If-Match", etag)
+		status, _, _ := ts.send(r)
+		return status
+	}
+
+	if status := update("Vaiana"); status != http.StatusOK {
+		t.Fatalf("got status %d for the first update; want %d", status, http.StatusOK)
+	}
+
+	// The second update was based on the version the first one replaced.
+	if status := update("Oceania"); status != http.StatusPreconditionFailed {
+		t.Fatalf("got status %d for the stale update; want %d", status, http.StatusPreconditionFailed)
+	}
+
+	_, _, js := ts.do(http.MethodGet, "/v1/movies/1", token, "")
+	if title := js["movie"].(map[string]interface{})["title"]; title != "Vaiana" {
+		t.Errorf("got title %v; want %q", title, "Vaiana")
+	}
+}
+
+func TestDeleteMovie(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+
+	status, _, js := ts.do(http.MethodDelete, "/v1/movies/1", token, "")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusOK, js)
+	}
+
+	status, _, _ = ts.do(http.MethodGet, "/v1/movies/1", token, "")
+	if status != http.StatusNotFound {
+		t.Errorf("got status %d for a deleted movie; want %d", status, http.StatusNotFound)
+	}
+
+	status, _, _ = ts.do(http.MethodDelete, "/v1/movies/1", token, "")
+	if status != http.StatusNotFound {
+		t.Errorf("got status %d deleting a deleted movie; want %d", status, http.StatusNotFound)
+	}
+}
+
+func TestShowMovieFields(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+
+	ts.do(http.MethodPost, "/v1/movies", token, testMovie)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantKeys   []string
+	}{
+		{"Fields", "?fields=year,title", http.StatusOK, []string{"title", "year"}},
+		{"Fields and ratings", "?fields=title&include=ratings", http.StatusOK, []string{"ratings", "title"}},
+		{"Unknown field", "?fields=rating", http.StatusUnprocessableEntity, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(http.MethodGet, "/v1/movies/1"+tt.query, token, "")
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			if status != http.StatusOK {
+				return
+			}
+
+			keys := []string{}
+			for key := range js["movie"].(map[string]interface{}) {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("got fields %v; want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestListMoviesCursor(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.newUser("alice@example.com", true, "movies:read")
+
+	for i, year := range []int32{2001, 1999, 2001, 2005, 1999, 2001} {
+		movie := &data.Movie{Title: fmt.Sprintf("Movie %d", i+1), Year: year, Duration: 90, Genres: []string{"drama"}}
+
+		err := ts.app.models.Movies.Insert(movie)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// list reads a page of the movies by year, newest first, and returns their ids and the metadata.
+	list := func(query string) ([]int64, map[string]interface{}) {
+		t.Helper()
+
+		status, _, js := ts.do(http.MethodGet, "/v1/movies?sort=-year&page_size=2"+query, token, "")
+		if status != http.StatusOK {
+			t.Fatalf("got status %d; want %d: %v", status, http.StatusOK, js)
+		}
+
+		ids := []int64{}
+		for _, movie := range js["movies"].([]interface{}) {
+			ids = append(ids, int64(movie.(map[string]interface{})["id"].(float64)))
+		}
+
+		return ids, js["metadata"].(map[string]interface{})
+	}
+
+	cursor := func(metadata map[string]interface{}, key string) string {
+		c, _ := metadata[key].(string)
+		return url.QueryEscape(c)
+	}
+
+	// Movies of the same year follow each other in order of id.
+	pages := [][]int64{}
+
+	ids, metadata := list("")
+	pages = append(pages, ids)
+
+	// A movie added before the position of the cursor doesn't shift the following pages.
+	err := ts.app.models.Movies.Insert(&data.Movie{Title: "Movie 7", Year: 2010, Duration: 90, Genres: []string{"drama"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for metadata["next_cursor"] != nil {
+		ids, metadata = list("&cursor=" + cursor(metadata, "next_cursor"))
+		pages = append(pages, ids)
+	}
+
+	if want := [][]int64{{4, 1}, {3, 6}, {2, 5}}; !reflect.DeepEqual(pages, want) {
+		t.Fatalf("got pages %v; want %v", pages, want)
+	}
+
+	ids, _ = list("&cursor=" + cursor(metadata, "prev_cursor"))
+	if want := []int64{3, 6}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("got %v going back from the last page; want %v", ids, want)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"Different sort", "/v1/movies?sort=title&cursor=" + cursor(metadata, "prev_cursor")},
+		{"With a page", "/v1/movies?sort=-year&page=2&cursor=" + cursor(metadata, "prev_cursor")},
+		{"Malformed", "/v1/movies?sort=-year&cursor=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(http.MethodGet, tt.query, token, "")
+			if status != http.StatusUnprocessableEntity {
+				t.Fatalf("got status %d; want %d: %v", status, http.StatusUnprocessableEntity, js)
+			}
+
+			if errs, _ := js["error"].(map[string]interface{}); errs["cursor"] == nil {
+				t.Errorf("got error %v; want one for the cursor", js["error"])
+			}
+		})
+	}
+}
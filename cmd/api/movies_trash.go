@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// listTrashHandler lists the movies which have been deleted but not yet purged.
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 5, v)
+
+	// most recently deleted first by default
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movies.GetAllDeleted(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.presentMovies(r, movies...)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movies": movies, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreMovieHandler takes a movie back out of the trash.
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var movie *data.Movie
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		movie, err = tx.Movies.Restore(id)
+		if err != nil {
+			return err
+		}
+		// restoring doesn't change any fields, so the prior state matches the restored one
+		return app.recordRevision(tx, r, data.RevisionRestore, movie, movie)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.presentMovies(r, movie)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrashHandler permanently deletes the movies which have been in the trash for longer than the configured
+// retention period, along with the blobs of their images.
+func (app *application) purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	deletedBefore := time.Now().Add(-app.config.trash.retention)
+
+	purged, err := app.models.Movies.Purge(deletedBefore)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, movie := range purged {
+		for _, image := range movie.Images {
+			app.deleteBlobs(image.Keys()...)
+		}
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"purged": len(purged), "deleted_before": deletedBefore.Truncate(time.Second)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRatingRequiresActivation(t *testing.T) {
+	ts := newTestServer(t)
+	editor := ts.newUser("alice@example.com", true, "movies:read", "movies:write")
+	inactive := ts.newUser("bob@example.com", false, "movies:read")
+
+	ts.do(http.MethodPost, "/v1/movies", editor, testMovie)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+	}{
+		{"Rate", http.MethodPut, "/v1/movies/1/rating", `{"score": 5}`, http.StatusForbidden},
+		{"Show rating", http.MethodGet, "/v1/movies/1/rating", "", http.StatusForbidden},
+		{"Remove rating", http.MethodDelete, "/v1/movies/1/rating", "", http.StatusForbidden},
+		{"List ratings", http.MethodGet, "/v1/users/me/ratings", "", http.StatusForbidden},
+		// Inactive users keep the rest of their permissions.
+		{"Show movie", http.MethodGet, "/v1/movies/1", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(tt.method, tt.url, inactive, tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+		})
+	}
+
+	status, _, js := ts.do(http.MethodPut, "/v1/movies/1/rating", editor, `{"score": 5}`)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d rating as an activated user; want %d: %v", status, http.StatusOK, js)
+	}
+
+	movie := js["movie"].(map[string]interface{})
+	if movie["rating_count"] != float64(1) || movie["rating_average"] != float64(5) {
+		t.Errorf("got rating_count %v and rating_average %v; want 1 and 5", movie["rating_count"], movie["rating_average"])
+	}
+}
@@ -18,17 +18,51 @@ func (app *application) routes() http.Handler {
 	// register the relevant methods
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.getMoviesHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.getMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	// Images are uploaded, merged away and purged with the trash outside movieRoutes(), so that batches, whose
+	// transaction may roll back, never store or delete blobs. The stored images can be downloaded by anyone, e.g. from
+	// an <img> tag.
+	app.movieRoutes(router, map[string]http.HandlerFunc{
+		"trash": app.requirePermission("movies:purge", app.purgeTrashHandler),
+	})
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/images", app.requirePermission("movies:read", app.getMovieImagesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/images/:kind", app.requirePermission("movies:write", app.uploadMovieImageHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/images/:kind", app.requirePermission("movies:write", app.deleteMovieImageHandler))
+	router.HandlerFunc(http.MethodGet, imagesPath+"/*key", app.serveImageHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/merge", app.requirePermission("movies:write", app.mergeMovieHandler))
+
+	// Batches of movie operations, each of which checks its own permission
+	router.HandlerFunc(http.MethodPost, "/v1/batch", app.requireActivateUser(app.batchHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission("movies:read", app.getPeopleHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission("movies:write", app.createPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission("movies:read", app.getPersonHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id/filmography", app.requirePermission("movies:read", app.getFilmographyHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission("movies:write", app.updatePersonHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission("movies:write", app.deletePersonHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission("movies:read", app.listGenresHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.requirePermission("genres:write", app.createGenreHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:id", app.requirePermission("movies:read", app.getGenreHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/genres/:id", app.requirePermission("genres:write", app.updateGenreHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/genres/:id/merge", app.requirePermission("genres:write", app.mergeGenreHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/collections", app.requirePermission("movies:read", app.listCollectionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.requirePermission("collections:write", app.createCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id", app.requirePermission("movies:read", app.getCollectionHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:id", app.requirePermission("collections:write", app.updateCollectionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id", app.requirePermission("collections:write", app.deleteCollectionHandler))
 
 	// Users endpoint
 	router.HandlerFunc(http.MethodPost, "/v1/users/register", app.registerUserHandler)
 
 	// Activation endpoint
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/ratings", app.requireActivatedRater(app.listUserRatingsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlist", app.requirePermission("watchlist:use", app.listWatchlistHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/watchlist", app.requirePermission("watchlist:use", app.addWatchlistItemHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/watchlist/:id", app.requirePermission("watchlist:use", app.updateWatchlistItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlist/:id", app.requirePermission("watchlist:use", app.removeWatchlistItemHandler))
 
 	// authentication endpoint ==> /v1/login
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
@@ -37,6 +71,52 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
 	// Wrap the router with the recovery middleware.
+	// Negotiate the format of every response.
 	// Use the authenticate() middleware on all requests.
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	// Replay the responses to retried POST requests which carry an Idempotency-Key header.
+	// Read the format durations are written in for all requests.
+	// Read the languages movie titles are written in for all requests.
+	return app.metrics(app.recoverPanic(app.negotiate(app.enableCORS(app.rateLimit(app.authenticate(app.idempotent(app.durationFormat(app.titleLanguages(router)))))))))
+}
+
+// movieRoutes registers the routes under /v1/movies. They are shared by routes() and the router which runs the
+// operations of a batch. deleteSegments adds routes such as DELETE /v1/movies/trash which only routes() serves, as
+// httprouter allows a single handler for DELETE /v1/movies/:id.
+func (app *application) movieRoutes(router *httprouter.Router, deleteSegments map[string]http.HandlerFunc) {
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticSegments(app.methodNotAllowedResponse, map[string]http.HandlerFunc{
+		"import": app.requirePermission("movies:write", app.importMoviesHandler),
+	}))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.restoreMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revert", app.requirePermission("movies:write", app.revertMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/history", app.requirePermission("movies:read", app.getMovieHistoryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.requirePermission("movies:read", app.getMovieCreditsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/credits", app.requirePermission("movies:write", app.updateMovieCreditsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/collections", app.requirePermission("movies:read", app.getMovieCollectionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/rating", app.requireActivatedRater(app.getRatingHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/rating", app.requireActivatedRater(app.setRatingHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/rating", app.requireActivatedRater(app.deleteRatingHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.getMoviesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticSegments(app.requirePermission("movies:read", app.getMovieHandler), map[string]http.HandlerFunc{
+		"export":  app.requirePermission("movies:read", app.exportMoviesHandler),
+		"suggest": app.requirePermission("movies:read", app.suggestMoviesHandler),
+		"trash":   app.requirePermission("movies:write", app.listTrashHandler),
+	}))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.staticSegments(app.requirePermission("movies:write", app.deleteMovieHandler), deleteSegments))
+}
+
+// httprouter doesn't allow a fixed path segment to share a position with a named parameter, so routes such as
+// /v1/movies/export are registered as entries in static and dispatched by the handler for /v1/movies/:id.
+func (app *application) staticSegments(next http.HandlerFunc, static map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := static[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+
+		next(w, r)
+	}
 }
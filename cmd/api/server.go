@@ -19,6 +19,8 @@ func (app *application) serve() error {
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
+		// Handlers which stream large bodies extend these timeouts on their connection.
+		ConnContext: app.contextSetConn,
 	}
 
 	// Create a shutdownError channel
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/blob"
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/jsonlog"
+)
+
+// routes() can only be called once per process, as metrics() publishes its expvar variables by name, so the tests
+// share one application and its handler. newTestServer() gives the application a fresh in-memory backend for every
+// test, which means tests must not run in parallel.
+var (
+	testApp     = &application{logger: jsonlog.New(io.Discard, jsonlog.LevelError)}
+	testHandler http.Handler
+	testRoutes  sync.Once
+)
+
+type testServer struct {
+	t   *testing.T
+	app *application
+}
+
+// newTestServer resets the shared application to an empty in-memory backend and returns a server for it.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	testRoutes.Do(func() {
+		testHandler = testApp.routes()
+	})
+
+	blobs, err := blob.NewLocal(t.TempDir(), imagesPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testApp.models = data.NewMemoryModels()
+	testApp.blobs = blobs
+	testApp.config = config{}
+	testApp.config.images.maxSize = 1 << 20
+	testApp.config.trash.retention = 30 * 24 * time.Hour
+	testApp.config.idempotency.ttl = 24 * time.Hour
+
+	// Wait for any email a test sends in the background before the next test swaps the backend out.
+	t.Cleanup(testApp.wg.Wait)
+
+	return &testServer{t: t, app: testApp}
+}
+
+// newUser adds a user with the password "pa55word" and the given permissions, and returns an authentication token
+// for them.
+func (ts *testServer) newUser(email string, activated bool, permissions ...string) string {
+	ts.t.Helper()
+
+	user := &data.User{Name: "Test User", Email: email, Activated: activated}
+
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	err = ts.app.models.User.Insert(user)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	err = ts.app.models.Permission.AddForUser(user.ID, permissions...)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	token, err := ts.app.models.Tokens.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+
+	return token.Plaintext
+}
+
+// newTestRequest returns a request carrying the token, if any, as a bearer token.
+func newTestRequest(method, url, token, body string) *http.Request {
+	r := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+// send serves a request and returns the status, headers and decoded JSON body of the response.
+func (ts *testServer) send(r *http.Request) (int, http.Header, map[string]interface{}) {
+	ts.t.Helper()
+
+	rr := httptest.NewRecorder()
+	testHandler.ServeHTTP(rr, r)
+
+	var js map[string]interface{}
+
+	err := json.NewDecoder(rr.Body).Decode(&js)
+	if err != nil {
+		ts.t.Fatalf("%s %s: decoding response: %v", r.Method, r.URL, err)
+	}
+
+	return rr.Code, rr.Header(), js
+}
+
+// do sends a request built by newTestRequest().
+func (ts *testServer) do(method, url, token, body string) (int, http.Header, map[string]interface{}) {
+	ts.t.Helper()
+	return ts.send(newTestRequest(method, url, token, body))
+}
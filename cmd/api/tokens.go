@@ -71,7 +71,7 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	// Encode the token to JSON and send it in the response along with a 201 Created status code.
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": res}, nil)
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"authentication_token": res}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
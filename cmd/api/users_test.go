@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+)
+
+func TestRegisterUser(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"Valid", `{"name": "Alice", "email": "alice@example.com", "password": "pa55word"}`, http.StatusCreated, ""},
+		{"Duplicate email", `{"name": "Alice", "email": "alice@example.com", "password": "pa55word"}`, http.StatusUnprocessableEntity, "email"},
+		{"Invalid email", `{"name": "Bob", "email": "bob", "password": "pa55word"}`, http.StatusUnprocessableEntity, "email"},
+		{"Short password", `{"name": "Bob", "email": "bob@example.com", "password": "pass"}`, http.StatusUnprocessableEntity, "password"},
+		{"Malformed JSON", `{"name": "Bob",`, http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(http.MethodPost, "/v1/users/register", "", tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			if tt.wantError != "" {
+				errs, _ := js["error"].(map[string]interface{})
+				if _, ok := errs[tt.wantError]; !ok {
+					t.Errorf("got error %v; want one for %q", js["error"], tt.wantError)
+				}
+			}
+
+			if status == http.StatusCreated {
+				user := js["user"].(map[string]interface{})
+				if user["activated"] != false {
+					t.Errorf("got activated %v for a new user; want false", user["activated"])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateAuthenticationToken(t *testing.T) {
+	ts := newTestServer(t)
+	ts.newUser("alice@example.com", true, "movies:read")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"Valid", `{"email": "alice@example.com", "password": "pa55word"}`, http.StatusCreated},
+		{"Wrong password", `{"email": "alice@example.com", "password": "wrongpa55word"}`, http.StatusUnauthorized},
+		{"Unknown email", `{"email": "bob@example.com", "password": "pa55word"}`, http.StatusUnauthorized},
+		{"Missing password", `{"email": "alice@example.com"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, js := ts.do(http.MethodPost, "/v1/tokens/authentication", "", tt.body)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+
+			if status != http.StatusCreated {
+				return
+			}
+
+			// The new token authenticates its user.
+			token := js["authentication_token"].(map[string]interface{})["token"].(string)
+
+			status, _, js = ts.do(http.MethodGet, "/v1/movies", token, "")
+			if status != http.StatusOK {
+				t.Errorf("got status %d with the new token; want %d: %v", status, http.StatusOK, js)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newTestServer(t)
+
+	reader := ts.newUser("alice@example.com", true, "movies:read")
+	inactive := ts.newUser("bob@example.com", false, "movies:read")
+	unpermitted := ts.newUser("carol@example.com", true)
+
+	user, err := ts.app.models.User.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := ts.app.models.Tokens.New(user.ID, -time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activation, err := ts.app.models.Tokens.New(user.ID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"Valid token", "Bearer " + reader, http.StatusOK},
+		{"No token", "", http.StatusUnauthorized},
+		{"Not a bearer token", "Basic " + reader, http.StatusUnauthorized},
+		{"Malformed token", "Bearer abc", http.StatusUnauthorized},
+		{"Unknown token", "Bearer ABCDEFGHIJKLMNOPQRSTUVWXYZ", http.StatusUnauthorized},
+		{"Expired token", "Bearer " + expired.Plaintext, http.StatusUnauthorized},
+		{"Activation token", "Bearer " + activation.Plaintext, http.StatusUnauthorized},
+		// Only the rating routes require an activated account.
+		{"Inactive user", "Bearer " + inactive, http.StatusOK},
+		{"Missing permission", "Bearer " + unpermitted, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRequest(http.MethodGet, "/v1/movies", "", "")
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			status, _, js := ts.send(r)
+			if status != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %v", status, tt.wantStatus, js)
+			}
+		})
+	}
+}
+
+func TestActivateUser(t *testing.T) {
+	ts := newTestServer(t)
+	inactive := ts.newUser("alice@example.com", false, "movies:read")
+
+	status, _, js := ts.do(http.MethodGet, "/v1/users/me/ratings", inactive, "")
+	if status != http.StatusForbidden {
+		t.Fatalf("got status %d before activation; want %d: %v", status, http.StatusForbidden, js)
+	}
+
+	user, err := ts.app.models.User.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activation, err := ts.app.models.Tokens.New(user.ID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"token": "` + activation.Plaintext + `"}`
+
+	status, _, js = ts.do(http.MethodPut, "/v1/users/activated", "", body)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d: %v", status, http.StatusOK, js)
+	}
+
+	if activated := js["user"].(map[string]interface{})["activated"]; activated != true {
+		t.Errorf("got activated %v; want true", activated)
+	}
+
+	status, _, js = ts.do(http.MethodGet, "/v1/users/me/ratings", inactive, "")
+	if status != http.StatusOK {
+		t.Errorf("got status %d once activated; want %d: %v", status, http.StatusOK, js)
+	}
+
+	// Activation tokens are deleted once used.
+	status, _, js = ts.do(http.MethodPut, "/v1/users/activated", "", body)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d reusing the token; want %d: %v", status, http.StatusUnprocessableEntity, js)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/data"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// listWatchlistHandler lists the authenticated user's watchlist, in their own order by default.
+func (app *application) listWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Watched *bool
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	// only the watched (or unwatched) items
+	if s := qs.Get("watched"); s != "" {
+		watched, err := strconv.ParseBool(s)
+		if err != nil {
+			v.AddError("watched", "must be true or false")
+		}
+		input.Watched = &watched
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "position")
+	input.Filters.SortSafelist = []string{
+		"position", "added_at", "watched_on", "title", "year",
+		"-position", "-added_at", "-watched_on", "-title", "-year",
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	items, metadata, err := app.models.Watchlist.GetAllForUser(user.ID, input.Watched, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, item := range items {
+		app.presentMovies(r, item.Movie)
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"watchlist": items, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateWatchlistItem checks the fields of a watchlist item which the user can set.
+func validateWatchlistItem(v *validator.Validator, item *data.WatchlistItem) {
+	v.Check(item.Position >= 0, "position", "must be a positive integer")
+
+	if item.WatchedOn != nil {
+		v.Check(!item.WatchedOn.After(time.Now()), "watched_on", "must not be in the future")
+	}
+}
+
+// addWatchlistItemHandler puts a movie on the authenticated user's watchlist, at the end unless a position is given.
+func (app *application) addWatchlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID   int64      `json:"movie_id"`
+		Position  int32      `json:"position"`
+		WatchedOn *data.Date `json:"watched_on"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	item := &data.WatchlistItem{
+		MovieID:   input.MovieID,
+		UserID:    user.ID,
+		Position:  input.Position,
+		WatchedOn: input.WatchedOn,
+	}
+
+	v := validator.New()
+
+	v.Check(item.MovieID > 0, "movie_id", "must be provided")
+	if validateWatchlistItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		err := tx.Watchlist.Add(item)
+		if err != nil {
+			return err
+		}
+
+		item, err = tx.Watchlist.Get(user.ID, item.MovieID)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("movie_id", "must refer to an existing movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateWatchlistItem):
+			v.AddError("movie_id", "is already on the watchlist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/watchlist/%d", item.MovieID))
+
+	app.presentMovies(r, item.Movie)
+
+	err = app.writeResponse(w, r, http.StatusCreated, envelope{"item": item}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWatchlistItemHandler moves an item of the authenticated user's watchlist and marks it as watched or not.
+// Setting watched to true without a watched_on date records today's date.
+func (app *application) updateWatchlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	item, err := app.models.Watchlist.Get(user.ID, id)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Position  *int32     `json:"position"`
+		Watched   *bool      `json:"watched"`
+		WatchedOn *data.Date `json:"watched_on"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if input.Position != nil {
+		v.Check(*input.Position > 0, "position", "must be a positive integer")
+		item.Position = *input.Position
+	}
+
+	switch {
+	case input.WatchedOn != nil:
+		v.Check(input.Watched == nil || *input.Watched, "watched", "must not be false when watched_on is provided")
+		item.WatchedOn = input.WatchedOn
+	case input.Watched != nil && *input.Watched:
+		if item.WatchedOn == nil {
+			today := data.NewDate(time.Now())
+			item.WatchedOn = &today
+		}
+	case input.Watched != nil:
+		item.WatchedOn = nil
+	}
+
+	if validateWatchlistItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		err := tx.Watchlist.Update(item)
+		if err != nil {
+			return err
+		}
+
+		item, err = tx.Watchlist.Get(user.ID, id)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.presentMovies(r, item.Movie)
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeWatchlistItemHandler takes a movie off the authenticated user's watchlist.
+func (app *application) removeWatchlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.getParamID(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Atomic(func(tx data.Models) error {
+		return tx.Watchlist.Remove(user.ID, id)
+	})
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			app.notFoundResponse(w, r)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeResponse(w, r, http.StatusOK, envelope{"message": "movie successfully removed from the watchlist"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
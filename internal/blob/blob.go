@@ -0,0 +1,124 @@
+// Package blob stores binary objects, such as uploaded images, under slash-separated keys.
+package blob
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when no object is stored under a key.
+var ErrNotFound = errors.New("blob: object not found")
+
+// ErrInvalidKey is returned for keys which are empty, absolute or climb out of the store with "..".
+var ErrInvalidKey = errors.New("blob: invalid key")
+
+// Store is implemented by every backend which can hold objects. Keys are slash-separated paths such as
+// "movies/1/poster.jpg".
+type Store interface {
+	// Put stores the object read from r under the key, replacing any object already there.
+	Put(key string, r io.Reader) error
+	// Open returns a reader for the object stored under the key, which the caller must close.
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the object stored under the key. Deleting a missing object isn't an error.
+	Delete(key string) error
+	// URL returns the address the object can be downloaded from.
+	URL(key string) string
+}
+
+// Local stores objects as files below a directory. It doesn't serve them itself: URL() joins the key to the base URL
+// of whichever handler does.
+type Local struct {
+	root    string
+	baseURL string
+}
+
+// NewLocal returns a store which keeps its files below root, creating the directory if needed.
+func NewLocal(root, baseURL string) (*Local, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{root: root, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// filename returns the path of the file holding the object stored under the key.
+func (l *Local) filename(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the object to a temporary file first and renames it into place, so that readers never see a partly
+// written object.
+func (l *Local) Put(key string, r io.Reader) error {
+	filename, err := l.filename(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filename)
+}
+
+func (l *Local) Open(key string) (io.ReadCloser, error) {
+	filename, err := l.filename(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (l *Local) Delete(key string) error {
+	filename, err := l.filename(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
@@ -0,0 +1,280 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// ErrMissingCollectionMovie is returned when a collection is saved with a movie which doesn't exist, such as one
+// purged after it was checked.
+var ErrMissingCollectionMovie = errors.New("collection movie doesn't exist")
+
+type CollectionModel struct {
+	DB DBTX
+}
+
+// Collection is an ordered group of movies, such as a trilogy or a cinematic universe. MovieIDs lists the movies in
+// the collection's order, including any which are in the trash, and a movie may belong to several collections.
+type Collection struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	MovieIDs    []int64   `json:"movie_ids"`
+	Version     int32     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(len(collection.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+
+	v.Check(len(collection.MovieIDs) <= 500, "movie_ids", "must not contain more than 500 movies")
+
+	seen := make(map[int64]bool, len(collection.MovieIDs))
+	for _, id := range collection.MovieIDs {
+		v.Check(id > 0, "movie_ids", "must only contain positive integers")
+		v.Check(!seen[id], "movie_ids", "must not contain duplicate values")
+		seen[id] = true
+	}
+}
+
+// Insert adds a collection along with its movies. It must be called inside Models.Atomic().
+func (m CollectionModel) Insert(collection *Collection) error {
+	query := `
+		INSERT INTO collections (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, collection.Name, collection.Description).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+	if err != nil {
+		return err
+	}
+
+	return m.setMovies(ctx, collection)
+}
+
+// setMovies replaces the movies of a collection with its MovieIDs, numbering their positions in order. It returns
+// ErrMissingCollectionMovie if one of them doesn't exist.
+func (m CollectionModel) setMovies(ctx context.Context, collection *Collection) error {
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM collection_movies WHERE collection_id = $1`, collection.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO collection_movies (collection_id, movie_id, position)
+		SELECT $1, input.movie_id, input.ord
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS input (movie_id, ord)`
+
+	_, err = m.DB.ExecContext(ctx, query, collection.ID, pq.Array(nonNilInt64s(collection.MovieIDs)))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrMissingCollectionMovie
+		}
+		return err
+	}
+
+	return nil
+}
+
+// collectionColumns lists the columns scanned by scanCollection(), including the ids of the movies in order.
+const collectionColumns = `
+	collections.id, collections.created_at, collections.name, collections.description, collections.version,
+	ARRAY(
+		SELECT collection_movies.movie_id FROM collection_movies
+		WHERE collection_movies.collection_id = collections.id
+		ORDER BY collection_movies.position
+	) AS movie_ids`
+
+func (m CollectionModel) Get(id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM collections
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	collection, err := scanCollection(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// Update saves a collection's name and description and replaces its movies. It must be called inside
+// Models.Atomic().
+func (m CollectionModel) Update(collection *Collection) error {
+	query := `
+		UPDATE collections
+		SET name = $1, description = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []interface{}{collection.Name, collection.Description, collection.ID, collection.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.Version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	return m.setMovies(ctx, collection)
+}
+
+// Delete removes a collection. The movies in it are left alone.
+func (m CollectionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM collections WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll lists the collections whose name contains the given text, ignoring case, or every collection if it is empty.
+func (m CollectionModel) GetAll(name string, filters Filters) ([]*Collection, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), `+collectionColumns+`
+		FROM collections
+		WHERE (strpos(lower(name), lower($1)) > 0 OR $1 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	collections := []*Collection{}
+
+	for rows.Next() {
+		collection, err := scanCollection(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		collections = append(collections, collection)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return collections, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// GetAllForMovie lists the collections a movie belongs to, by name.
+func (m CollectionModel) GetAllForMovie(movieID int64) ([]*Collection, error) {
+	query := `
+		SELECT ` + collectionColumns + `
+		FROM collections
+		WHERE EXISTS (
+			SELECT 1 FROM collection_movies
+			WHERE collection_movies.collection_id = collections.id AND collection_movies.movie_id = $1)
+		ORDER BY name ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*Collection{}
+
+	for rows.Next() {
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
+
+// scanCollection scans the collectionColumns of a row. Any extra columns selected before them are scanned into
+// leading.
+func scanCollection(row interface{ Scan(...interface{}) error }, leading ...interface{}) (*Collection, error) {
+	var collection Collection
+
+	dest := append(leading,
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.Name,
+		&collection.Description,
+		&collection.Version,
+		pq.Array(&collection.MovieIDs),
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	if collection.MovieIDs == nil {
+		collection.MovieIDs = []int64{}
+	}
+
+	return &collection, nil
+}
+
+// nonNilInt64s returns an empty slice in place of nil, which pq.Array() would send as NULL rather than '{}'.
+func nonNilInt64s(values []int64) []int64 {
+	if values == nil {
+		return []int64{}
+	}
+	return values
+}
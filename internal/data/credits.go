@@ -0,0 +1,237 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// Define constants for the roles a person can be credited with.
+const (
+	RoleDirector = "director"
+	RoleWriter   = "writer"
+	RoleActor    = "actor"
+	RoleComposer = "composer"
+)
+
+var CreditRoles = []string{RoleDirector, RoleWriter, RoleActor, RoleComposer}
+
+type CreditModel struct {
+	DB DBTX
+}
+
+// Credit links a person to a movie. Character is only set for actors. Credits are listed by ascending BillingOrder.
+// PersonName is filled in when listing the credits of a movie, and MovieTitle and MovieYear when listing the credits
+// of a person.
+type Credit struct {
+	ID           int64  `json:"id"`
+	MovieID      int64  `json:"movie_id"`
+	PersonID     int64  `json:"person_id"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order"`
+	PersonName   string `json:"person_name,omitempty"`
+	MovieTitle   string `json:"movie_title,omitempty"`
+	MovieYear    int32  `json:"movie_year,omitempty"`
+}
+
+// ValidateCredits checks the full list of credits for a movie. Errors are keyed by the position of the credit in the
+// list, e.g. "credits[2].role".
+func ValidateCredits(v *validator.Validator, credits []*Credit) {
+	v.Check(len(credits) <= 500, "credits", "must not contain more than 500 credits")
+
+	for i, credit := range credits {
+		key := fmt.Sprintf("credits[%d]", i)
+
+		v.Check(credit.PersonID > 0, key+".person_id", "must be provided")
+		v.Check(validator.In(credit.Role, CreditRoles...), key+".role", "must be one of director, writer, actor or composer")
+		v.Check(credit.BillingOrder >= 0, key+".billing_order", "must not be negative")
+
+		if credit.Role == RoleActor {
+			v.Check(credit.Character != "", key+".character", "must be provided for an actor")
+			v.Check(len(credit.Character) <= 500, key+".character", "must not be more than 500 bytes long")
+		} else {
+			v.Check(credit.Character == "", key+".character", "must only be provided for an actor")
+		}
+	}
+}
+
+// GetAllForMovie lists the credits of a movie in billing order.
+func (m CreditModel) GetAllForMovie(movieID int64) ([]*Credit, error) {
+	query := `
+		SELECT credits.id, credits.movie_id, credits.person_id, credits.role, credits.character,
+		credits.billing_order, people.name
+		FROM credits
+		INNER JOIN people ON people.id = credits.person_id
+		WHERE credits.movie_id = $1
+		ORDER BY credits.billing_order ASC, credits.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+			&credit.PersonName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// GetAllForMovies lists the credits of several movies in billing order, keyed by movie id. Movies without credits
+// are given an empty list.
+func (m CreditModel) GetAllForMovies(movieIDs []int64) (map[int64][]*Credit, error) {
+	query := `
+		SELECT credits.id, credits.movie_id, credits.person_id, credits.role, credits.character,
+		credits.billing_order, people.name
+		FROM credits
+		INNER JOIN people ON people.id = credits.person_id
+		WHERE credits.movie_id = ANY($1)
+		ORDER BY credits.movie_id ASC, credits.billing_order ASC, credits.id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := make(map[int64][]*Credit, len(movieIDs))
+	for _, id := range movieIDs {
+		credits[id] = []*Credit{}
+	}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+			&credit.PersonName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		credits[credit.MovieID] = append(credits[credit.MovieID], &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+// GetAllForPerson lists the credits of a person on movies which are not in the trash, sorted by a column of the
+// movies table.
+func (m CreditModel) GetAllForPerson(personID int64, filters Filters) ([]*Credit, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), credits.id, credits.movie_id, credits.person_id, credits.role, credits.character,
+		credits.billing_order, movies.title, movies.year
+		FROM credits
+		INNER JOIN movies ON movies.id = credits.movie_id
+		WHERE credits.person_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY movies.%s %s, credits.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, personID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(
+			&totalRecords,
+			&credit.ID,
+			&credit.MovieID,
+			&credit.PersonID,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+			&credit.MovieTitle,
+			&credit.MovieYear,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return credits, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// ReplaceForMovie swaps the credits of a movie for the given list, setting the ID and MovieID of each credit. It
+// should be called inside Models.Atomic() so that a failure part way through leaves the old credits in place.
+func (m CreditModel) ReplaceForMovie(movieID int64, credits []*Credit) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM credits WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO credits (movie_id, person_id, role, character, billing_order)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+
+	for _, credit := range credits {
+		credit.MovieID = movieID
+
+		args := []interface{}{movieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+		err = m.DB.QueryRowContext(ctx, query, args...).Scan(&credit.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// generates a custom JSON type for calendar dates
+package data
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidDateFormat = errors.New("invalid date format")
+
+const dateLayout = "2006-01-02"
+
+// Date is a calendar date without a time of day, written as "YYYY-MM-DD" in JSON and stored in date columns.
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the date on which t falls in UTC.
+func NewDate(t time.Time) Date {
+	year, month, day := t.UTC().Date()
+	return Date{time.Date(year, month, day, 0, 0, 0, 0, time.UTC)}
+}
+
+func (d Date) String() string {
+	return d.Format(dateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+func (d *Date) UnmarshalJSON(jsonValue []byte) error {
+	unQuotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	t, err := time.Parse(dateLayout, unQuotedJSONValue)
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	*d = Date{t}
+
+	return nil
+}
+
+// Value stores the date in a date column.
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan reads a date column, which lib/pq returns as a time.Time at midnight UTC.
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d = NewDate(v)
+		return nil
+	case string:
+		return d.UnmarshalJSON([]byte(strconv.Quote(v)))
+	case []byte:
+		return d.UnmarshalJSON([]byte(strconv.Quote(string(v))))
+	}
+
+	return fmt.Errorf("cannot scan %T into a date", src)
+}
@@ -0,0 +1,276 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// NormalizeTitle returns the key two titles share when they likely name the same film: the title in lower case, with
+// runs of anything but letters and digits collapsed into one space and a leading "the", "a" or "an" dropped. It
+// agrees with the movie_title_key() SQL function.
+func NormalizeTitle(title string) string {
+	key := strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+
+	for _, article := range []string{"the ", "a ", "an "} {
+		if strings.HasPrefix(key, article) {
+			return key[len(article):]
+		}
+	}
+
+	return key
+}
+
+// FindDuplicates lists the movies outside the trash with the same normalised title and year, which are likely the
+// same film. It first takes a lock on the title and year which is held until the end of the transaction, so that two
+// requests adding the same film can't both find no duplicate and both insert it. It should be called inside
+// Models.Atomic(), along with the insert it guards.
+func (m MovieModel) FindDuplicates(title string, year int32) ([]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext(movie_title_key($1) || ':' || $2::integer))`, title, year)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, title, original_language, titles, year, duration, genres, version, rating_average, rating_count, images, created_at
+		FROM movies
+		WHERE year = $2 AND movie_title_key(title) = movie_title_key($1) AND deleted_at IS NULL
+		ORDER BY id ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, title, year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.OriginalLanguage,
+			&movie.Titles,
+			&movie.Year,
+			&movie.Duration,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.RatingAverage,
+			&movie.RatingCount,
+			&movie.Images,
+			&movie.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// Merge folds the source movie into the target and deletes it, leaving a redirect from its id. Ratings, credits,
+// watchlist items, collection places and revisions move to the target; where a user rated or listed both movies, a
+// person has the same role in both or a collection holds both, the target's row is kept. The target takes the
+// source's images of any kind it lacks, and the source's other images are returned so that their blobs can be
+// deleted. Like Update(), Merge fails with ErrEditConflict if either movie's version has moved on, and it updates the
+// target in place. It should be called inside a transaction.
+func (m MovieModel) Merge(source, target *Movie) ([]*Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var version int32
+	var sourceImages MovieImages
+
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT version, images FROM movies
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE`, source.ID).Scan(&version, &sourceImages)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if errors.Is(err, sql.ErrNoRows) || version != source.Version {
+		return nil, ErrEditConflict
+	}
+
+	err = m.DB.QueryRowContext(ctx, `
+		UPDATE movies
+		SET images = $1::jsonb || images, version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING version, images`, sourceImages, target.ID, target.Version).Scan(&target.Version, &target.Images)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEditConflict
+		}
+		return nil, err
+	}
+
+	// Drop the source's rows which clash with the target's, then move the rest across.
+	_, err = m.DB.ExecContext(ctx, `
+		DELETE FROM ratings AS s
+		USING ratings AS t
+		WHERE s.movie_id = $1 AND t.movie_id = $2 AND s.user_id = t.user_id`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `UPDATE ratings SET movie_id = $2 WHERE movie_id = $1`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = RatingModel{DB: m.DB}.updateAggregates(ctx, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.DB.QueryRowContext(ctx, `SELECT rating_average, rating_count FROM movies WHERE id = $1`, target.ID).Scan(&target.RatingAverage, &target.RatingCount)
+	if err != nil {
+		return nil, err
+	}
+
+	// The source's credits are billed after the target's.
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE credits AS s
+		SET movie_id = $2, billing_order = s.billing_order + (
+			SELECT coalesce(max(billing_order), 0) FROM credits WHERE movie_id = $2
+		)
+		WHERE s.movie_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM credits AS t WHERE t.movie_id = $2 AND t.person_id = s.person_id AND t.role = s.role
+		)`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove() closes the gap each clashing item leaves in its watchlist.
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT s.user_id
+		FROM watchlist_items AS s
+		JOIN watchlist_items AS t ON t.user_id = s.user_id AND t.movie_id = $2
+		WHERE s.movie_id = $1`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := []int64{}
+	for rows.Next() {
+		var userID int64
+		err = rows.Scan(&userID)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, userID := range userIDs {
+		err = WatchlistModel{DB: m.DB}.Remove(userID, source.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = m.DB.ExecContext(ctx, `UPDATE watchlist_items SET movie_id = $2 WHERE movie_id = $1`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE movie_revisions
+		SET movie_id = $2, merged_from = coalesce(merged_from, $1)
+		WHERE movie_id = $1`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The target takes the source's place in its collections, unless it is already in the same collection.
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE collections
+		SET version = version + 1
+		WHERE id IN (SELECT collection_id FROM collection_movies WHERE movie_id = $1)`, source.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE collection_movies AS s
+		SET movie_id = $2
+		WHERE s.movie_id = $1 AND NOT EXISTS (
+			SELECT 1 FROM collection_movies AS t WHERE t.collection_id = s.collection_id AND t.movie_id = $2
+		)`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Movies merged into the source earlier now redirect straight to the target.
+	_, err = m.DB.ExecContext(ctx, `UPDATE movie_redirects SET target_id = $2 WHERE target_id = $1`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `INSERT INTO movie_redirects (source_id, target_id) VALUES ($1, $2)`, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Whatever is left of the source, such as its clashing credits, goes with it.
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM movies WHERE id = $1`, source.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return droppedImages(sourceImages, target.Images), nil
+}
+
+// droppedImages lists the images of a merged movie which the movie it was merged into didn't take.
+func droppedImages(source, merged MovieImages) []*Image {
+	dropped := []*Image{}
+
+	for _, kind := range ImageKinds {
+		if image := source[kind]; image != nil && merged[kind] != nil && merged[kind].Key != image.Key {
+			dropped = append(dropped, image)
+		}
+	}
+
+	return dropped
+}
+
+// Redirect returns the id of the movie a merged movie was folded into, or ErrRecordNotFound if the id was never
+// merged.
+func (m MovieModel) Redirect(id int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var targetID int64
+
+	err := m.DB.QueryRowContext(ctx, `SELECT target_id FROM movie_redirects WHERE source_id = $1`, id).Scan(&targetID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrRecordNotFound
+		}
+		return 0, err
+	}
+
+	return targetID, nil
+}
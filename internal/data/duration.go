@@ -2,57 +2,142 @@
 package data
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
 var ErrInvalidDurationFormat = errors.New("invalid duration format")
 
-type Duration int32
+// DurationFormatHelp describes the accepted duration formats, for reporting ErrInvalidDurationFormat against a field.
+const DurationFormatHelp = `must be a whole number of minutes, or a string such as "102 mins", "1h 42m" or "PT1H42M"`
+
+var (
+	// minsRX matches "102 mins".
+	minsRX = regexp.MustCompile(`^(\d+) mins$`)
+	// hoursMinutesRX matches "1h 42m", "1h42m", "1h" and "42m".
+	hoursMinutesRX = regexp.MustCompile(`^(?:(\d+)h)? ?(?:(\d+)m)?$`)
+	// iso8601RX matches the ISO 8601 durations "PT1H42M", "PT1H" and "PT42M".
+	iso8601RX = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?$`)
+)
 
-func (d *Duration) MarshalJSON() ([]byte, error) {
-	// adds mins to the value
-	jsonValue := fmt.Sprintf("%d mins", d)
+// Duration is a length of time in whole minutes. It is read from JSON as a number of minutes or as a string in any
+// of the formats parsed by ParseDuration(), and written in the zero DurationFormat, as movies are by default.
+type Duration int32
 
-	// format to a valid json string (quoted string)
-	quotedJSONValue := strconv.Quote(jsonValue)
+func (d Duration) MarshalJSON() ([]byte, error) {
+	var format DurationFormat
 
-	// convert the quoted string value to a byte slice and return it
-	return []byte(quotedJSONValue), nil
+	return json.Marshal(format.format(int32(d)))
 }
 
 func (d *Duration) UnmarshalJSON(jsonValue []byte) error {
-	var parts []string
+	// a bare number is a number of minutes
+	if i, err := strconv.ParseInt(string(jsonValue), 10, 32); err == nil {
+		*d = Duration(i)
+		return nil
+	}
+
 	// remove the double quotes for the JSON value
 	unQuotedJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidDurationFormat
 	}
 
-	// added validation logic
-	if !strings.Contains(unQuotedJSONValue, " ") {
-		return ErrInvalidDurationFormat
+	*d, err = ParseDuration(unQuotedJSONValue)
+	return err
+}
+
+// ParseDuration reads a duration given as a whole number of minutes ("102"), in minutes ("102 mins"), in hours and
+// minutes ("1h 42m") or as an ISO 8601 duration ("PT1H42M").
+func ParseDuration(s string) (Duration, error) {
+	s = strings.TrimSpace(s)
+
+	if i, err := strconv.ParseInt(s, 10, 32); err == nil {
+		return Duration(i), nil
 	}
 
-	parts = strings.Split(unQuotedJSONValue, " ")
+	if m := minsRX.FindStringSubmatch(s); m != nil {
+		return durationFromParts("", m[1])
+	}
 
-	// sanity check
-	if len(parts) != 2 || parts[1] != "mins" {
+	if m := hoursMinutesRX.FindStringSubmatch(strings.ToLower(s)); m != nil && s != "" {
+		return durationFromParts(m[1], m[2])
+	}
 
-		return ErrInvalidDurationFormat
+	if m := iso8601RX.FindStringSubmatch(strings.ToUpper(s)); m != nil && len(s) > 2 {
+		return durationFromParts(m[1], m[2])
 	}
 
-	// convert the string to int32
-	i, err := strconv.ParseInt(parts[0], 10, 32)
-	if err != nil {
-		return ErrInvalidDurationFormat
+	return 0, ErrInvalidDurationFormat
+}
+
+// durationFromParts adds up the hours and minutes matched by one of the duration patterns. Either may be empty.
+func durationFromParts(hours, minutes string) (Duration, error) {
+	var total int64
+
+	if hours != "" {
+		h, err := strconv.ParseInt(hours, 10, 32)
+		if err != nil {
+			return 0, ErrInvalidDurationFormat
+		}
+		total += h * 60
+	}
+
+	if minutes != "" {
+		m, err := strconv.ParseInt(minutes, 10, 32)
+		if err != nil {
+			return 0, ErrInvalidDurationFormat
+		}
+		total += m
+	}
+
+	if total > 1<<31-1 {
+		return 0, ErrInvalidDurationFormat
 	}
 
-	// convert the i to duration type
+	return Duration(total), nil
+}
+
+// DurationFormat selects how the durations of movies are written in responses.
+type DurationFormat string
+
+const (
+	DurationMinutes DurationFormat = "minutes" // 102
+	DurationMins    DurationFormat = "mins"    // "102 mins"
+	DurationHM      DurationFormat = "hm"      // "1h 42m"
+	DurationISO8601 DurationFormat = "iso8601" // "PT1H42M"
+)
 
-	*d = Duration(i)
+var DurationFormats = []string{string(DurationMinutes), string(DurationMins), string(DurationHM), string(DurationISO8601)}
+
+// format returns the JSON value of a duration in the format. The zero format writes a number of minutes.
+func (f DurationFormat) format(minutes int32) interface{} {
+	h, m := minutes/60, minutes%60
+
+	switch f {
+	case DurationMins:
+		return fmt.Sprintf("%d mins", minutes)
+	case DurationHM:
+		switch {
+		case h == 0:
+			return fmt.Sprintf("%dm", m)
+		case m == 0:
+			return fmt.Sprintf("%dh", h)
+		}
+		return fmt.Sprintf("%dh %dm", h, m)
+	case DurationISO8601:
+		switch {
+		case h == 0:
+			return fmt.Sprintf("PT%dM", m)
+		case m == 0:
+			return fmt.Sprintf("PT%dH", h)
+		}
+		return fmt.Sprintf("PT%dH%dM", h, m)
+	}
 
-	return nil
+	return minutes
 }
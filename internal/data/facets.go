@@ -0,0 +1,143 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Define constants for the facets which can be counted over a movie list.
+const (
+	FacetGenres         = "genres"
+	FacetDecade         = "decade"
+	FacetDurationBucket = "duration_bucket"
+)
+
+var FacetSafelist = []string{FacetGenres, FacetDecade, FacetDurationBucket}
+
+// FacetCount is the number of movies in a list which share one value of a facet.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets holds the counts of each requested facet, keyed by facet name.
+type Facets map[string][]FacetCount
+
+// durationBuckets lists the upper bound in minutes (exclusive) and label of each duration bucket, in order. The last
+// bucket has no upper bound.
+var durationBuckets = []struct {
+	below int32
+	label string
+}{
+	{90, "under 90 mins"},
+	{120, "90-119 mins"},
+	{150, "120-149 mins"},
+	{0, "150+ mins"},
+}
+
+// durationBucket returns the label of the bucket holding a duration.
+func durationBucket(duration int32) string {
+	for _, b := range durationBuckets[:len(durationBuckets)-1] {
+		if duration < b.below {
+			return b.label
+		}
+	}
+	return durationBuckets[len(durationBuckets)-1].label
+}
+
+// durationBucketSQL returns a CASE expression computing durationBucket() of the duration column, along with one
+// giving the position of the bucket so that buckets can be listed in order.
+func durationBucketSQL() (label, order string) {
+	var labels, orders strings.Builder
+
+	labels.WriteString("CASE")
+	orders.WriteString("CASE")
+
+	for i, b := range durationBuckets[:len(durationBuckets)-1] {
+		fmt.Fprintf(&labels, " WHEN duration < %d THEN %s", b.below, pq.QuoteLiteral(b.label))
+		fmt.Fprintf(&orders, " WHEN duration < %d THEN %d", b.below, i)
+	}
+
+	fmt.Fprintf(&labels, " ELSE %s END", pq.QuoteLiteral(durationBuckets[len(durationBuckets)-1].label))
+	fmt.Fprintf(&orders, " ELSE %d END", len(durationBuckets)-1)
+
+	return labels.String(), orders.String()
+}
+
+// decade returns the label of the decade a year falls in, e.g. "1990s".
+func decade(year int32) string {
+	return strconv.Itoa(int(year/10*10)) + "s"
+}
+
+// facetQuery returns the query counting the values of a facet over the movies matched by the conditions. Genres are
+// listed by descending count, while decades and duration buckets are listed in their natural order.
+func facetQuery(facet, conditions string) string {
+	switch facet {
+	case FacetGenres:
+		return fmt.Sprintf(`
+			SELECT genre, count(*)
+			FROM movies, unnest(genres) AS genre
+			WHERE %s
+			GROUP BY genre
+			ORDER BY count(*) DESC, genre ASC`, conditions)
+	case FacetDecade:
+		return fmt.Sprintf(`
+			SELECT (year / 10 * 10)::text || 's', count(*)
+			FROM movies
+			WHERE %s
+			GROUP BY year / 10
+			ORDER BY year / 10 ASC`, conditions)
+	case FacetDurationBucket:
+		label, order := durationBucketSQL()
+		return fmt.Sprintf(`
+			SELECT %s, count(*)
+			FROM movies
+			WHERE %s
+			GROUP BY 1, %s
+			ORDER BY %s ASC`, label, conditions, order, order)
+	}
+
+	panic("unsupported facet: " + facet)
+}
+
+// Facets counts the values of each facet over every movie matching the filter, regardless of paging.
+func (m MovieModel) Facets(filter MovieFilter, facets []string) (Facets, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result := make(Facets, len(facets))
+
+	for _, facet := range facets {
+		rows, err := m.DB.QueryContext(ctx, facetQuery(facet, filter.conditions()), filter.args()...)
+		if err != nil {
+			return nil, err
+		}
+
+		counts := []FacetCount{}
+		for rows.Next() {
+			var count FacetCount
+
+			err := rows.Scan(&count.Value, &count.Count)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts = append(counts, count)
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		result[facet] = counts
+	}
+
+	return result, nil
+}
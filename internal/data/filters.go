@@ -1,17 +1,30 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
 
 	"github.com/lorezi/duxfilm/internal/validator"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	// Cursor is an opaque keyset position returned in Metadata. When it is set the page is read relative to the
+	// cursor instead of using Page and an OFFSET.
+	Cursor string
+	// Fields, when set, limits the columns read for each row of a movie list to those listed, plus the columns needed
+	// to identify and page through the rows. Other lists ignore it.
+	Fields []string
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -20,6 +33,17 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	if f.Cursor != "" {
+		v.Check(f.Page == 1, "cursor", "must not be combined with page")
+
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			v.AddError("cursor", "invalid cursor")
+			return
+		}
+		v.Check(c.Sort == f.Sort, "cursor", "was issued for a different sort value")
+	}
 }
 
 func (f Filters) sortColumn() string {
@@ -49,11 +73,15 @@ func (f Filters) offset() int {
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_size,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_size,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+	// Facets is only set when facet counts were requested for a movie list.
+	Facets Facets `json:"facets,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -70,3 +98,101 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 
 }
+
+// cursor is the decoded form of Filters.Cursor. It records the sort the cursor was issued for, the value of the sort
+// column and the id of the row it points at, and whether the page should be read backwards from that row.
+type cursor struct {
+	Sort     string `json:"s"`
+	Key      string `json:"k"`
+	ID       int64  `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+func (c cursor) encode() string {
+	js, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return c, ErrInvalidCursor
+	}
+
+	// Every sort column except title is numeric, so the key must parse as a number.
+	switch strings.TrimPrefix(c.Sort, "-") {
+	case "title":
+	case "rating_average", "relevance":
+		if _, err := strconv.ParseFloat(c.Key, 64); err != nil {
+			return c, ErrInvalidCursor
+		}
+	default:
+		if _, err := strconv.ParseInt(c.Key, 10, 64); err != nil {
+			return c, ErrInvalidCursor
+		}
+	}
+
+	return c, nil
+}
+
+// cursor decodes Filters.Cursor. It returns false when keyset pagination wasn't requested.
+func (f Filters) cursor() (cursor, bool) {
+	if f.Cursor == "" {
+		return cursor{}, false
+	}
+
+	c, err := decodeCursor(f.Cursor)
+	if err != nil {
+		panic("unvalidated cursor parameter: " + f.Cursor)
+	}
+
+	return c, true
+}
+
+// keysetCondition returns the SQL predicate selecting the rows which follow (or, for a backward cursor, precede) the
+// cursor row in the ORDER BY sortColumn() sortDirection(), id ASC ordering. keyParam and idParam are the
+// placeholders holding the cursor's key and id.
+func (f Filters) keysetCondition(c cursor, keyParam, idParam string) string {
+	column := f.sortColumn()
+
+	ascending := f.sortDirection() == "ASC"
+	if c.Backward {
+		ascending = !ascending
+	}
+
+	keyOp, idOp := "<", ">"
+	if ascending {
+		keyOp = ">"
+	}
+	if c.Backward {
+		idOp = "<"
+	}
+
+	return fmt.Sprintf("(%[1]s %[2]s %[4]s OR (%[1]s = %[4]s AND id %[3]s %[5]s))", column, keyOp, idOp, keyParam, idParam)
+}
+
+// keysetOrder returns the ORDER BY clause used to read a keyset page. Backward pages are read in reverse and must be
+// flipped by the caller.
+func (f Filters) keysetOrder(c cursor) string {
+	if !c.Backward {
+		return fmt.Sprintf("%s %s, id ASC", f.sortColumn(), f.sortDirection())
+	}
+
+	direction := "ASC"
+	if f.sortDirection() == "ASC" {
+		direction = "DESC"
+	}
+
+	return fmt.Sprintf("%s %s, id DESC", f.sortColumn(), direction)
+}
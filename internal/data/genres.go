@@ -0,0 +1,403 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+var (
+	ErrDuplicateGenreSlug  = errors.New("genre slug is already in use")
+	ErrDuplicateGenreAlias = errors.New("genre alias is already in use")
+)
+
+var (
+	SlugRX = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+	// slugSeparatorRX matches the runs of characters which Slugify() turns into a hyphen. The migration creating the
+	// genres table uses the same expression to convert the genres already stored on movies.
+	slugSeparatorRX = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type GenreModel struct {
+	DB DBTX
+}
+
+// Genre is an entry of the genre taxonomy. Movies store the Slug of each of their genres, and any of the Aliases is
+// accepted in its place when a movie is saved. MovieCount is the number of movies, outside the trash, with the genre.
+type Genre struct {
+	ID         int64     `json:"id"`
+	Slug       string    `json:"slug"`
+	Name       string    `json:"name"`
+	Aliases    []string  `json:"aliases"`
+	MovieCount int       `json:"movie_count"`
+	Version    int32     `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// defaultGenres is the taxonomy a new database starts with, as seeded by the migration creating the genres table.
+var defaultGenres = []Genre{
+	{Slug: "action", Name: "Action"},
+	{Slug: "adventure", Name: "Adventure"},
+	{Slug: "animation", Name: "Animation", Aliases: []string{"animated", "cartoon"}},
+	{Slug: "comedy", Name: "Comedy"},
+	{Slug: "crime", Name: "Crime"},
+	{Slug: "documentary", Name: "Documentary"},
+	{Slug: "drama", Name: "Drama"},
+	{Slug: "family", Name: "Family"},
+	{Slug: "fantasy", Name: "Fantasy"},
+	{Slug: "history", Name: "History", Aliases: []string{"historical"}},
+	{Slug: "horror", Name: "Horror"},
+	{Slug: "music", Name: "Music", Aliases: []string{"musical"}},
+	{Slug: "mystery", Name: "Mystery"},
+	{Slug: "romance", Name: "Romance", Aliases: []string{"romantic"}},
+	{Slug: "sci-fi", Name: "Science Fiction", Aliases: []string{"science-fiction", "scifi", "sf"}},
+	{Slug: "thriller", Name: "Thriller"},
+	{Slug: "war", Name: "War"},
+	{Slug: "western", Name: "Western"},
+}
+
+// Slugify turns a genre as it might be typed, such as "Sci Fi", into the form of a slug, "sci-fi". Only the ASCII
+// letters and digits are kept.
+func Slugify(s string) string {
+	return strings.Trim(slugSeparatorRX.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(len(genre.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(genre.Slug, SlugRX), "slug", "must only contain lowercase letters, digits and single hyphens")
+
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(genre.Aliases) <= 20, "aliases", "must not contain more than 20 aliases")
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+	for _, alias := range genre.Aliases {
+		v.Check(validator.Matches(alias, SlugRX), "aliases", "must only contain slugs")
+		v.Check(len(alias) <= 100, "aliases", "must not contain values more than 100 bytes long")
+		v.Check(alias != genre.Slug, "aliases", "must not contain the slug")
+	}
+}
+
+// lockGenres locks the genres table against other writers until the end of the transaction, so that the check for
+// slugs and aliases already in use can't race with another change.
+func (m GenreModel) lockGenres(ctx context.Context) error {
+	_, err := m.DB.ExecContext(ctx, `LOCK TABLE genres IN SHARE ROW EXCLUSIVE MODE`)
+	return err
+}
+
+// checkUnique returns ErrDuplicateGenreSlug or ErrDuplicateGenreAlias if a genre other than the one with the given id
+// already uses the slug or one of the aliases as its slug or an alias.
+func (m GenreModel) checkUnique(ctx context.Context, genre *Genre) error {
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM genres WHERE id <> $1 AND (slug = $2 OR $2 = ANY(aliases))),
+			EXISTS (SELECT 1 FROM genres WHERE id <> $1 AND (slug = ANY($3) OR aliases && $3))`
+
+	var slugTaken, aliasTaken bool
+
+	err := m.DB.QueryRowContext(ctx, query, genre.ID, genre.Slug, pq.Array(nonNilStrings(genre.Aliases))).Scan(&slugTaken, &aliasTaken)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case slugTaken:
+		return ErrDuplicateGenreSlug
+	case aliasTaken:
+		return ErrDuplicateGenreAlias
+	}
+
+	return nil
+}
+
+// Insert adds a genre to the taxonomy. It must be called inside Models.Atomic().
+func (m GenreModel) Insert(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.lockGenres(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = m.checkUnique(ctx, genre)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO genres (slug, name, aliases)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version`
+
+	args := []interface{}{genre.Slug, genre.Name, pq.Array(nonNilStrings(genre.Aliases))}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+}
+
+// genreColumns lists the columns scanned by scanGenre(), including the count of the movies with the genre.
+const genreColumns = `
+	genres.id, genres.created_at, genres.slug, genres.name, genres.aliases, genres.version,
+	(SELECT count(*) FROM movies WHERE movies.genres @> ARRAY[genres.slug] AND movies.deleted_at IS NULL) AS movie_count`
+
+func (m GenreModel) Get(id int64) (*Genre, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + genreColumns + `
+		FROM genres
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	genre, err := scanGenre(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return genre, nil
+}
+
+// Update saves a genre's name, slug and aliases. When the slug changes the movies with the genre are rewritten to use
+// the new slug, which bumps their versions, and the old slug is kept as an alias so that it is still accepted. It
+// must be called inside Models.Atomic().
+func (m GenreModel) Update(genre *Genre) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.lockGenres(ctx)
+	if err != nil {
+		return err
+	}
+
+	var oldSlug string
+
+	err = m.DB.QueryRowContext(ctx, `SELECT slug FROM genres WHERE id = $1 AND version = $2`, genre.ID, genre.Version).Scan(&oldSlug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
+		return err
+	}
+
+	if genre.Slug != oldSlug {
+		genre.Aliases = renamedAliases(genre.Aliases, oldSlug, genre.Slug)
+	}
+
+	err = m.checkUnique(ctx, genre)
+	if err != nil {
+		return err
+	}
+
+	if genre.Slug != oldSlug {
+		_, err = m.DB.ExecContext(ctx, `
+			UPDATE movies
+			SET genres = array_replace(genres, $1, $2), version = version + 1
+			WHERE genres @> ARRAY[$1]`, oldSlug, genre.Slug)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE genres
+		SET slug = $1, name = $2, aliases = $3, version = version + 1
+		WHERE id = $4
+		RETURNING version`
+
+	args := []interface{}{genre.Slug, genre.Name, pq.Array(nonNilStrings(genre.Aliases)), genre.ID}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&genre.Version)
+}
+
+// renamedAliases returns the aliases of a genre whose slug is changing: the old slug becomes an alias, and the new
+// slug is no longer one if it was before.
+func renamedAliases(aliases []string, oldSlug, newSlug string) []string {
+	renamed := []string{}
+	for _, alias := range aliases {
+		if alias != newSlug && alias != oldSlug {
+			renamed = append(renamed, alias)
+		}
+	}
+	return append(renamed, oldSlug)
+}
+
+// mergedAliases returns the aliases of the genre another is merged into: its own, followed by the slug and aliases of
+// the merged genre.
+func mergedAliases(target, source *Genre) []string {
+	merged := append([]string{}, target.Aliases...)
+	for _, alias := range append([]string{source.Slug}, source.Aliases...) {
+		if !validator.In(alias, merged...) {
+			merged = append(merged, alias)
+		}
+	}
+	return merged
+}
+
+// Merge folds the source genre into the target and deletes it. Movies with the source genre are rewritten to have the
+// target genre instead, which bumps their versions, and the source's slug and aliases become aliases of the target. It
+// returns ErrRecordNotFound if either genre doesn't exist, and must be called inside Models.Atomic().
+func (m GenreModel) Merge(sourceID, targetID int64) (*Genre, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.lockGenres(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := m.Get(sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := m.Get(targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace the source slug with the target's, dropping it instead where the movie already has both.
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE movies
+		SET genres = CASE
+			WHEN genres @> ARRAY[$2] THEN array_remove(genres, $1)
+			ELSE array_replace(genres, $1, $2)
+		END, version = version + 1
+		WHERE genres @> ARRAY[$1]`, source.Slug, target.Slug)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM genres WHERE id = $1`, source.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE genres
+		SET aliases = $1, version = version + 1
+		WHERE id = $2`, pq.Array(mergedAliases(target, source)), target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Get(target.ID)
+}
+
+// GetAll lists the genres of the taxonomy along with their movie counts.
+func (m GenreModel) GetAll(filters Filters) ([]*Genre, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), `+genreColumns+`
+		FROM genres
+		ORDER BY %s %s, id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	genres := []*Genre{}
+
+	for rows.Next() {
+		genre, err := scanGenre(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		genres = append(genres, genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return genres, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Resolve maps each of the names onto the slug of the genre it is the slug or an alias of, once slugified. The slugs
+// are returned in the same order as the names, with an empty string in place of any name which isn't a known genre.
+func (m GenreModel) Resolve(names []string) ([]string, error) {
+	slugs := make([]string, len(names))
+	for i, name := range names {
+		slugs[i] = Slugify(name)
+	}
+
+	query := `
+		SELECT genres.slug
+		FROM unnest($1::text[]) WITH ORDINALITY AS input (name, ord)
+		LEFT JOIN genres ON genres.slug = input.name OR input.name = ANY(genres.aliases)
+		ORDER BY input.ord`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(slugs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resolved := []string{}
+
+	for rows.Next() {
+		var slug sql.NullString
+
+		err := rows.Scan(&slug)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, slug.String)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+// scanGenre scans the genreColumns of a row. Any extra columns selected before them are scanned into leading.
+func scanGenre(row interface{ Scan(...interface{}) error }, leading ...interface{}) (*Genre, error) {
+	var genre Genre
+
+	dest := append(leading,
+		&genre.ID,
+		&genre.CreatedAt,
+		&genre.Slug,
+		&genre.Name,
+		pq.Array(&genre.Aliases),
+		&genre.Version,
+		&genre.MovieCount,
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	if genre.Aliases == nil {
+		genre.Aliases = []string{}
+	}
+
+	return &genre, nil
+}
@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyRecord remembers a request made with an Idempotency-Key header, so that a retry of it can be answered
+// with the same response. Keys belong to the user who sent them; anonymous requests share user id 0. While the request
+// is still running Status is 0 and ExpiresAt is the time after which it is presumed lost.
+type IdempotencyRecord struct {
+	UserID      int64
+	Key         string
+	Fingerprint []byte
+	Status      int
+	Header      map[string][]string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+type IdempotencyModel struct {
+	DB DBTX
+}
+
+// Reserve claims the key of a record whose request is about to run. If an unexpired record already holds the key it
+// is returned instead, and nothing is stored. The fingerprint of the request may be empty until Complete() stores it.
+func (m IdempotencyModel) Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// The existing record can expire and be deleted between the two statements, in which case the insert is retried.
+	for attempt := 0; attempt < 3; attempt++ {
+		now := time.Now()
+
+		var userID int64
+
+		err := m.DB.QueryRowContext(ctx, `
+			INSERT INTO idempotency_keys (user_id, key, fingerprint, expires_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, status = NULL, headers = NULL, body = NULL, expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= $5
+			RETURNING user_id`, record.UserID, record.Key, record.Fingerprint, record.ExpiresAt, now).Scan(&userID)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		existing := IdempotencyRecord{UserID: record.UserID, Key: record.Key}
+
+		var header []byte
+
+		err = m.DB.QueryRowContext(ctx, `
+			SELECT fingerprint, coalesce(status, 0), headers, body, expires_at
+			FROM idempotency_keys
+			WHERE user_id = $1 AND key = $2 AND expires_at > $3`, record.UserID, record.Key, now).Scan(
+			&existing.Fingerprint,
+			&existing.Status,
+			&header,
+			&existing.Body,
+			&existing.ExpiresAt,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header != nil {
+			err = json.Unmarshal(header, &existing.Header)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return &existing, nil
+	}
+
+	return nil, errors.New("idempotency key is changing hands too quickly")
+}
+
+// Complete stores the fingerprint of the request of a reserved record and the response to it, along with its new
+// expiry.
+func (m IdempotencyModel) Complete(record *IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = $3, headers = $4, body = $5, expires_at = $6, fingerprint = $7
+		WHERE user_id = $1 AND key = $2`
+
+	args := []interface{}{record.UserID, record.Key, record.Status, string(header), record.Body, record.ExpiresAt, record.Fingerprint}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Renew extends the expiry of a key which is still reserved, so that a request which runs for a long time isn't
+// presumed lost. Keys which have been completed are left alone.
+func (m IdempotencyModel) Renew(userID int64, key string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `
+		UPDATE idempotency_keys
+		SET expires_at = $3
+		WHERE user_id = $1 AND key = $2 AND status IS NULL`, userID, key, expiresAt)
+	return err
+}
+
+// Release gives up a reserved key without storing a response, so that the request can be retried.
+func (m IdempotencyModel) Release(userID int64, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND status IS NULL`, userID, key)
+	return err
+}
+
+// DeleteExpired deletes the records which have expired.
+func (m IdempotencyModel) DeleteExpired() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, time.Now())
+	return err
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ImageKinds lists the kinds of artwork a movie can have, at most one of each.
+var ImageKinds = []string{"poster", "backdrop"}
+
+type ImageModel struct {
+	DB DBTX
+}
+
+// Image is a piece of artwork attached to a movie. The original upload is stored under Key, and the resized copies
+// of it are listed in Thumbnails, smallest first.
+type Image struct {
+	Key         string      `json:"key"`
+	URL         string      `json:"url"`
+	ContentType string      `json:"content_type"`
+	Width       int         `json:"width"`
+	Height      int         `json:"height"`
+	Size        int64       `json:"size"`
+	Thumbnails  []Thumbnail `json:"thumbnails"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// Thumbnail is a resized copy of an image.
+type Thumbnail struct {
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Keys returns the keys of the blobs holding the image and its thumbnails.
+func (i *Image) Keys() []string {
+	keys := []string{i.Key}
+	for _, thumbnail := range i.Thumbnails {
+		keys = append(keys, thumbnail.Key)
+	}
+	return keys
+}
+
+// MovieImages holds the images of a movie by kind. It is stored in the images column of the movies table as a JSON
+// object.
+type MovieImages map[string]*Image
+
+func (mi MovieImages) Value() (driver.Value, error) {
+	if mi == nil {
+		return "{}", nil
+	}
+
+	// A string rather than []byte, which the driver would send as bytea.
+	js, err := json.Marshal(mi)
+	return string(js), err
+}
+
+func (mi *MovieImages) Scan(src interface{}) error {
+	var js []byte
+
+	switch src := src.(type) {
+	case []byte:
+		js = src
+	case string:
+		js = []byte(src)
+	case nil:
+		*mi = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into MovieImages", src)
+	}
+
+	images := MovieImages{}
+	err := json.Unmarshal(js, &images)
+	if err != nil {
+		return err
+	}
+
+	*mi = images
+	return nil
+}
+
+// Set attaches an image of a kind to a movie which is not in the trash, and returns the image it replaced, if any.
+func (m ImageModel) Set(movieID int64, kind string, image *Image) (*Image, error) {
+	js, err := json.Marshal(image)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		WITH prior AS (
+			SELECT images -> $2::text AS image FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		)
+		UPDATE movies
+		SET images = jsonb_set(images, ARRAY[$2::text], $3::jsonb)
+		FROM prior
+		WHERE id = $1
+		RETURNING prior.image`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var prior []byte
+
+	err = m.DB.QueryRowContext(ctx, query, movieID, kind, string(js)).Scan(&prior)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return unmarshalImage(prior)
+}
+
+// Remove detaches the image of a kind from a movie which is not in the trash, and returns it.
+func (m ImageModel) Remove(movieID int64, kind string) (*Image, error) {
+	query := `
+		WITH prior AS (
+			SELECT images -> $2::text AS image FROM movies WHERE id = $1 AND deleted_at IS NULL AND images ? $2::text FOR UPDATE
+		)
+		UPDATE movies
+		SET images = images - $2::text
+		FROM prior
+		WHERE id = $1
+		RETURNING prior.image`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var prior []byte
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, kind).Scan(&prior)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return unmarshalImage(prior)
+}
+
+// unmarshalImage reads an image stored as JSON. It returns nil for SQL or JSON null.
+func unmarshalImage(js []byte) (*Image, error) {
+	if js == nil {
+		return nil, nil
+	}
+
+	var image *Image
+	err := json.Unmarshal(js, &image)
+	return image, err
+}
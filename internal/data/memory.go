@@ -0,0 +1,406 @@
+package data
+
+import (
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryStore holds the tables shared by the in-memory models. A single mutex guards every table so that cross-table
+// lookups (such as finding the user for a token) always see a consistent view, just like a join in PostgreSQL would.
+type memoryStore struct {
+	mu sync.RWMutex
+
+	// txMu serialises transactions started with Models.Atomic().
+	txMu sync.Mutex
+
+	memoryTables
+
+	// idempotency records are kept out of memoryTables, so that a transaction rolling back never loses the key of a
+	// request running alongside it.
+	idempotency map[idempotencyKey]IdempotencyRecord
+}
+
+// memoryTables holds every table of the in-memory backend. Rows are stored by value and replaced rather than
+// modified in place, so a shallow copy of each map is enough to snapshot a table.
+type memoryTables struct {
+	movies   map[int64]Movie
+	movieSeq int64
+
+	// redirects map the ids of merged movies to the movies they were merged into.
+	redirects map[int64]int64
+
+	// revisions are keyed by movie id and kept in insertion order.
+	revisions   map[int64][]Revision
+	revisionSeq int64
+
+	people    map[int64]Person
+	personSeq int64
+
+	// credits are keyed by movie id.
+	credits   map[int64][]Credit
+	creditSeq int64
+
+	// ratings are keyed by movie id and then by user id.
+	ratings map[int64]map[int64]Rating
+
+	// watchlist items are keyed by user id and then by movie id.
+	watchlist map[int64]map[int64]WatchlistItem
+
+	genres   map[int64]Genre
+	genreSeq int64
+
+	collections   map[int64]Collection
+	collectionSeq int64
+
+	users   map[int64]User
+	userSeq int64
+
+	// tokens are keyed by the string form of their SHA-256 hash.
+	tokens map[string]Token
+
+	// permissionCodes mirrors the rows of the permissions table; AddForUser() ignores codes which are not listed here.
+	permissionCodes []string
+	userPermissions map[int64]map[string]bool
+}
+
+func newMemoryStore() *memoryStore {
+	s := &memoryStore{
+		memoryTables: memoryTables{
+			movies:          make(map[int64]Movie),
+			redirects:       make(map[int64]int64),
+			revisions:       make(map[int64][]Revision),
+			people:          make(map[int64]Person),
+			credits:         make(map[int64][]Credit),
+			ratings:         make(map[int64]map[int64]Rating),
+			watchlist:       make(map[int64]map[int64]WatchlistItem),
+			genres:          make(map[int64]Genre),
+			collections:     make(map[int64]Collection),
+			users:           make(map[int64]User),
+			tokens:          make(map[string]Token),
+			permissionCodes: []string{"movies:read", "movies:write", "movies:purge", "watchlist:use", "genres:write", "collections:write"},
+			userPermissions: make(map[int64]map[string]bool),
+		},
+		idempotency: make(map[idempotencyKey]IdempotencyRecord),
+	}
+
+	s.seedGenres()
+
+	return s
+}
+
+// clone returns a copy of the tables which shares no maps with the original.
+func (t memoryTables) clone() memoryTables {
+	c := t
+
+	c.movies = make(map[int64]Movie, len(t.movies))
+	for k, v := range t.movies {
+		c.movies[k] = v
+	}
+
+	c.redirects = make(map[int64]int64, len(t.redirects))
+	for k, v := range t.redirects {
+		c.redirects[k] = v
+	}
+
+	c.revisions = make(map[int64][]Revision, len(t.revisions))
+	for k, v := range t.revisions {
+		c.revisions[k] = append([]Revision(nil), v...)
+	}
+
+	c.people = make(map[int64]Person, len(t.people))
+	for k, v := range t.people {
+		c.people[k] = v
+	}
+
+	c.credits = make(map[int64][]Credit, len(t.credits))
+	for k, v := range t.credits {
+		c.credits[k] = append([]Credit(nil), v...)
+	}
+
+	c.ratings = make(map[int64]map[int64]Rating, len(t.ratings))
+	for k, v := range t.ratings {
+		c.ratings[k] = make(map[int64]Rating, len(v))
+		for userID, rating := range v {
+			c.ratings[k][userID] = rating
+		}
+	}
+
+	c.watchlist = make(map[int64]map[int64]WatchlistItem, len(t.watchlist))
+	for k, v := range t.watchlist {
+		c.watchlist[k] = make(map[int64]WatchlistItem, len(v))
+		for movieID, item := range v {
+			c.watchlist[k][movieID] = item
+		}
+	}
+
+	c.genres = make(map[int64]Genre, len(t.genres))
+	for k, v := range t.genres {
+		c.genres[k] = v
+	}
+
+	c.collections = make(map[int64]Collection, len(t.collections))
+	for k, v := range t.collections {
+		c.collections[k] = v
+	}
+
+	c.users = make(map[int64]User, len(t.users))
+	for k, v := range t.users {
+		c.users[k] = v
+	}
+
+	c.tokens = make(map[string]Token, len(t.tokens))
+	for k, v := range t.tokens {
+		c.tokens[k] = v
+	}
+
+	c.userPermissions = make(map[int64]map[string]bool, len(t.userPermissions))
+	for k, v := range t.userPermissions {
+		c.userPermissions[k] = make(map[string]bool, len(v))
+		for code, granted := range v {
+			c.userPermissions[k][code] = granted
+		}
+	}
+
+	return c
+}
+
+// NewMemoryModels returns a Models instance whose data lives in process memory. It honours the same semantics as the
+// PostgreSQL models and is intended for handler tests and local demos; nothing is persisted between runs.
+func NewMemoryModels() Models {
+	store := newMemoryStore()
+
+	models := store.models()
+	models.atomic = store.atomic
+
+	return models
+}
+
+func (s *memoryStore) models() Models {
+	return Models{
+		Movies:      memoryMovieModel{store: s},
+		Revisions:   memoryRevisionModel{store: s},
+		People:      memoryPersonModel{store: s},
+		Credits:     memoryCreditModel{store: s},
+		Ratings:     memoryRatingModel{store: s},
+		Images:      memoryImageModel{store: s},
+		Watchlist:   memoryWatchlistModel{store: s},
+		Genres:      memoryGenreModel{store: s},
+		Collections: memoryCollectionModel{store: s},
+		Idempotency: memoryIdempotencyModel{store: s},
+		Tokens:      memoryTokenModel{store: s},
+		User:        memoryUserModel{store: s},
+		Permission:  memoryPermissionModel{store: s},
+	}
+}
+
+// atomic emulates a transaction by snapshotting the tables and restoring them if fn fails. Transactions are
+// serialised with each other, but writes made outside a transaction while it is running are lost if it rolls back.
+func (s *memoryStore) atomic(fn func(tx Models) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.RLock()
+	saved := s.memoryTables.clone()
+	s.mu.RUnlock()
+
+	// Roll back if fn panics, as NewModels() does.
+	defer func() {
+		if p := recover(); p != nil {
+			s.mu.Lock()
+			s.memoryTables = saved
+			s.mu.Unlock()
+			panic(p)
+		}
+	}()
+
+	err := fn(s.models())
+	if err != nil {
+		s.mu.Lock()
+		s.memoryTables = saved
+		s.mu.Unlock()
+	}
+
+	return err
+}
+
+type memoryUserModel struct {
+	store *memoryStore
+}
+
+// emailTaken reports whether another user already uses the email address. The comparison is case-insensitive to match
+// the citext column in PostgreSQL. The caller must hold the store mutex.
+func (s *memoryStore) emailTaken(email string, exceptID int64) bool {
+	for id, u := range s.users {
+		if id != exceptID && strings.EqualFold(u.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyUser returns a copy of the user which doesn't share the password hash or plaintext with the original.
+func copyUser(user User) User {
+	user.Password = password{hash: append([]byte(nil), user.Password.hash...)}
+	return user
+}
+
+func (u memoryUserModel) Insert(user *User) error {
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+
+	if u.store.emailTaken(user.Email, 0) {
+		return ErrDuplicateEmail
+	}
+
+	u.store.userSeq++
+	user.ID = u.store.userSeq
+	user.CreatedAt = time.Now().Truncate(time.Second)
+	user.Version = 1
+
+	u.store.users[user.ID] = copyUser(*user)
+
+	return nil
+}
+
+func (u memoryUserModel) GetByEmail(email string) (*User, error) {
+	u.store.mu.RLock()
+	defer u.store.mu.RUnlock()
+
+	for _, user := range u.store.users {
+		if strings.EqualFold(user.Email, email) {
+			found := copyUser(user)
+			return &found, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (u memoryUserModel) Update(user *User) error {
+	u.store.mu.Lock()
+	defer u.store.mu.Unlock()
+
+	if u.store.emailTaken(user.Email, user.ID) {
+		return ErrDuplicateEmail
+	}
+
+	current, ok := u.store.users[user.ID]
+	if !ok || current.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	user.Version++
+	u.store.users[user.ID] = copyUser(*user)
+
+	return nil
+}
+
+func (u memoryUserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	u.store.mu.RLock()
+	defer u.store.mu.RUnlock()
+
+	token, ok := u.store.tokens[string(tokenHash[:])]
+	if !ok || token.Scope != tokenScope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	user, ok := u.store.users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	found := copyUser(user)
+	return &found, nil
+}
+
+type memoryTokenModel struct {
+	store *memoryStore
+}
+
+func (t memoryTokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Insert(token)
+	return token, err
+}
+
+func (t memoryTokenModel) Insert(token *Token) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	// The tokens table references users with ON DELETE CASCADE, so a token for an unknown user is rejected.
+	if _, ok := t.store.users[token.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	t.store.tokens[string(token.Hash)] = Token{
+		Hash:   append([]byte(nil), token.Hash...),
+		UserID: token.UserID,
+		// PostgreSQL stores the expiry with second precision.
+		Expiry: token.Expiry.Truncate(time.Second),
+		Scope:  token.Scope,
+	}
+
+	return nil
+}
+
+func (t memoryTokenModel) DeleteAllForUser(scope string, userID int64) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	for hash, token := range t.store.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(t.store.tokens, hash)
+		}
+	}
+
+	return nil
+}
+
+type memoryPermissionModel struct {
+	store *memoryStore
+}
+
+func (p memoryPermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	p.store.mu.RLock()
+	defer p.store.mu.RUnlock()
+
+	var permissions Permissions
+	for _, code := range p.store.permissionCodes {
+		if p.store.userPermissions[userID][code] {
+			permissions = append(permissions, code)
+		}
+	}
+
+	return permissions, nil
+}
+
+func (p memoryPermissionModel) AddForUser(userID int64, codes ...string) error {
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+
+	if _, ok := p.store.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	granted := p.store.userPermissions[userID]
+	if granted == nil {
+		granted = make(map[string]bool)
+		p.store.userPermissions[userID] = granted
+	}
+
+	for _, code := range codes {
+		if Permissions(p.store.permissionCodes).Include(code) {
+			granted[code] = true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryCollectionModel struct {
+	store *memoryStore
+}
+
+// copyCollection returns a copy of the collection which doesn't share its movie ids with the original.
+func copyCollection(collection Collection) Collection {
+	collection.MovieIDs = append([]int64{}, collection.MovieIDs...)
+	return collection
+}
+
+// inCollection reports whether a movie belongs to a collection, or true when collectionID is zero, mirroring the
+// collection condition of movieConditions. The caller must hold the store mutex.
+func (s *memoryStore) inCollection(movieID, collectionID int64) bool {
+	if collectionID == 0 {
+		return true
+	}
+
+	for _, id := range s.collections[collectionID].MovieIDs {
+		if id == movieID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replaceCollectionMovie puts the target in the source's place in every collection which holds the source, or drops
+// the source where the collection already holds the target, bumping the versions of the collections it changes. The
+// caller must hold the store mutex.
+func (s *memoryStore) replaceCollectionMovie(sourceID, targetID int64) {
+	for id, collection := range s.collections {
+		if !s.inCollection(sourceID, id) {
+			continue
+		}
+
+		hasTarget := s.inCollection(targetID, id)
+
+		movieIDs := []int64{}
+		for _, movieID := range collection.MovieIDs {
+			switch {
+			case movieID != sourceID:
+				movieIDs = append(movieIDs, movieID)
+			case !hasTarget:
+				movieIDs = append(movieIDs, targetID)
+			}
+		}
+
+		collection.MovieIDs = movieIDs
+		collection.Version++
+		s.collections[id] = collection
+	}
+}
+
+// removeCollectionMovie drops a movie from every collection, like ON DELETE CASCADE. The caller must hold the store
+// mutex.
+func (s *memoryStore) removeCollectionMovie(movieID int64) {
+	for id, collection := range s.collections {
+		movieIDs := []int64{}
+		for _, other := range collection.MovieIDs {
+			if other != movieID {
+				movieIDs = append(movieIDs, other)
+			}
+		}
+
+		collection.MovieIDs = movieIDs
+		s.collections[id] = collection
+	}
+}
+
+// missingMovie reports whether any movie of a collection doesn't exist, like the foreign key of collection_movies.
+// The caller must hold the store mutex.
+func (s *memoryStore) missingMovie(collection *Collection) bool {
+	for _, id := range collection.MovieIDs {
+		if _, ok := s.movies[id]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m memoryCollectionModel) Insert(collection *Collection) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if m.store.missingMovie(collection) {
+		return ErrMissingCollectionMovie
+	}
+
+	m.store.collectionSeq++
+	collection.ID = m.store.collectionSeq
+	collection.CreatedAt = time.Now().Truncate(time.Second)
+	collection.Version = 1
+
+	m.store.collections[collection.ID] = copyCollection(*collection)
+
+	return nil
+}
+
+func (m memoryCollectionModel) Get(id int64) (*Collection, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	collection, ok := m.store.collections[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	found := copyCollection(collection)
+	return &found, nil
+}
+
+func (m memoryCollectionModel) Update(collection *Collection) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current, ok := m.store.collections[collection.ID]
+	if !ok || current.Version != collection.Version {
+		return ErrEditConflict
+	}
+
+	if m.store.missingMovie(collection) {
+		return ErrMissingCollectionMovie
+	}
+
+	collection.Version++
+	m.store.collections[collection.ID] = copyCollection(*collection)
+
+	return nil
+}
+
+func (m memoryCollectionModel) Delete(id int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.collections[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.store.collections, id)
+
+	return nil
+}
+
+func (m memoryCollectionModel) GetAll(name string, filters Filters) ([]*Collection, Metadata, error) {
+	m.store.mu.RLock()
+
+	matched := []Collection{}
+	for _, collection := range m.store.collections {
+		if name == "" || strings.Contains(strings.ToLower(collection.Name), strings.ToLower(name)) {
+			matched = append(matched, copyCollection(collection))
+		}
+	}
+
+	m.store.mu.RUnlock()
+
+	column, desc := filters.sortColumn(), filters.sortDirection() == "DESC"
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := compareCollections(&matched[i], &matched[j], column)
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	totalRecords := len(matched)
+	start, end := pageBounds(totalRecords, filters)
+
+	collections := []*Collection{}
+	for i := start; i < end; i++ {
+		collections = append(collections, &matched[i])
+	}
+
+	return collections, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// compareCollections compares two collections on a sort column.
+func compareCollections(a, b *Collection, column string) int {
+	switch column {
+	case "id":
+		return compareInt64(a.ID, b.ID)
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "created_at":
+		return compareInt64(a.CreatedAt.UnixNano(), b.CreatedAt.UnixNano())
+	}
+
+	panic("unsupported sort column: " + column)
+}
+
+func (m memoryCollectionModel) GetAllForMovie(movieID int64) ([]*Collection, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	collections := []*Collection{}
+	for id, collection := range m.store.collections {
+		if m.store.inCollection(movieID, id) {
+			found := copyCollection(collection)
+			collections = append(collections, &found)
+		}
+	}
+
+	sort.Slice(collections, func(i, j int) bool {
+		if c := strings.Compare(collections[i].Name, collections[j].Name); c != 0 {
+			return c < 0
+		}
+		return collections[i].ID < collections[j].ID
+	})
+
+	return collections, nil
+}
@@ -0,0 +1,149 @@
+package data
+
+import "sort"
+
+// FindDuplicates needs no lock of its own to stand in for the one MovieModel.FindDuplicates() takes, as the store runs
+// one transaction at a time.
+func (m memoryMovieModel) FindDuplicates(title string, year int32) ([]*Movie, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	key := NormalizeTitle(title)
+
+	movies := []*Movie{}
+	for _, movie := range m.store.movies {
+		if movie.DeletedAt == nil && movie.Year == year && NormalizeTitle(movie.Title) == key {
+			found := copyMovie(movie)
+			movies = append(movies, &found)
+		}
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		return movies[i].ID < movies[j].ID
+	})
+
+	return movies, nil
+}
+
+func (m memoryMovieModel) Merge(source, target *Movie) ([]*Image, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	src, ok := m.store.movies[source.ID]
+	if !ok || src.Version != source.Version || src.DeletedAt != nil {
+		return nil, ErrEditConflict
+	}
+
+	tgt, ok := m.store.movies[target.ID]
+	if !ok || tgt.Version != target.Version || tgt.DeletedAt != nil {
+		return nil, ErrEditConflict
+	}
+
+	// The target keeps its own images and takes the source's of any other kind.
+	images := make(MovieImages, len(src.Images)+len(tgt.Images))
+	for kind, image := range src.Images {
+		images[kind] = image
+	}
+	for kind, image := range tgt.Images {
+		images[kind] = image
+	}
+	tgt.Images = images
+	tgt.Version++
+
+	// Ratings and watchlist items of users who have both movies keep the target's.
+	if m.store.ratings[target.ID] == nil {
+		m.store.ratings[target.ID] = make(map[int64]Rating)
+	}
+	for userID, rating := range m.store.ratings[source.ID] {
+		if _, ok := m.store.ratings[target.ID][userID]; !ok {
+			rating.MovieID = target.ID
+			m.store.ratings[target.ID][userID] = rating
+		}
+	}
+	delete(m.store.ratings, source.ID)
+
+	for userID, items := range m.store.watchlist {
+		item, ok := items[source.ID]
+		if !ok {
+			continue
+		}
+
+		delete(items, source.ID)
+
+		if _, ok := items[target.ID]; ok {
+			m.store.shiftPositions(userID, item.Position+1, m.store.lastPosition(userID), -1)
+			continue
+		}
+
+		item.MovieID = target.ID
+		items[target.ID] = item
+	}
+
+	// The source's credits are billed after the target's, unless the person has the same role in both.
+	var lastBilling int32
+	for _, credit := range m.store.credits[target.ID] {
+		if credit.BillingOrder > lastBilling {
+			lastBilling = credit.BillingOrder
+		}
+	}
+
+	credits := append([]Credit(nil), m.store.credits[target.ID]...)
+	for _, credit := range m.store.credits[source.ID] {
+		clash := false
+		for _, existing := range m.store.credits[target.ID] {
+			if existing.PersonID == credit.PersonID && existing.Role == credit.Role {
+				clash = true
+				break
+			}
+		}
+
+		if !clash {
+			credit.MovieID = target.ID
+			credit.BillingOrder += lastBilling
+			credits = append(credits, credit)
+		}
+	}
+	m.store.credits[target.ID] = credits
+	delete(m.store.credits, source.ID)
+
+	m.store.replaceCollectionMovie(source.ID, target.ID)
+
+	revisions := append([]Revision(nil), m.store.revisions[target.ID]...)
+	for _, rev := range m.store.revisions[source.ID] {
+		rev.MovieID = target.ID
+		if rev.MergedFrom == 0 {
+			rev.MergedFrom = source.ID
+		}
+		revisions = append(revisions, rev)
+	}
+	m.store.revisions[target.ID] = revisions
+	delete(m.store.revisions, source.ID)
+
+	for id, targetID := range m.store.redirects {
+		if targetID == source.ID {
+			m.store.redirects[id] = target.ID
+		}
+	}
+	m.store.redirects[source.ID] = target.ID
+
+	delete(m.store.movies, source.ID)
+	m.store.movies[target.ID] = tgt
+	m.store.updateAggregates(target.ID)
+
+	merged := copyMovie(m.store.movies[target.ID])
+	*target = merged
+
+	return droppedImages(src.Images, merged.Images), nil
+}
+
+func (m memoryMovieModel) Redirect(id int64) (int64, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	targetID, ok := m.store.redirects[id]
+	if !ok {
+		return 0, ErrRecordNotFound
+	}
+
+	return targetID, nil
+}
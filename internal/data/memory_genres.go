@@ -0,0 +1,256 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryGenreModel struct {
+	store *memoryStore
+}
+
+// copyGenre returns a copy of the genre which doesn't share its aliases slice with the original.
+func copyGenre(genre Genre) Genre {
+	genre.Aliases = append([]string{}, genre.Aliases...)
+	return genre
+}
+
+// seedGenres adds the default taxonomy to the store, as the migration creating the genres table does.
+func (s *memoryStore) seedGenres() {
+	for _, genre := range defaultGenres {
+		s.genreSeq++
+		genre.ID = s.genreSeq
+		genre.CreatedAt = time.Now().Truncate(time.Second)
+		genre.Version = 1
+		s.genres[genre.ID] = copyGenre(genre)
+	}
+}
+
+// genreConflict mirrors GenreModel.checkUnique(). The caller must hold the store mutex.
+func (s *memoryStore) genreConflict(genre *Genre) error {
+	slugTaken, aliasTaken := false, false
+
+	for id, other := range s.genres {
+		if id == genre.ID {
+			continue
+		}
+
+		taken := append([]string{other.Slug}, other.Aliases...)
+		if containsAny(taken, []string{genre.Slug}) {
+			slugTaken = true
+		}
+		if containsAny(taken, genre.Aliases) {
+			aliasTaken = true
+		}
+	}
+
+	switch {
+	case slugTaken:
+		return ErrDuplicateGenreSlug
+	case aliasTaken:
+		return ErrDuplicateGenreAlias
+	}
+
+	return nil
+}
+
+// genreWithCount returns a copy of the genre along with the number of movies outside the trash which have it. The
+// caller must hold the store mutex.
+func (s *memoryStore) genreWithCount(genre Genre) Genre {
+	found := copyGenre(genre)
+	found.MovieCount = 0
+
+	for _, movie := range s.movies {
+		if movie.DeletedAt == nil && containsAll(movie.Genres, []string{genre.Slug}) {
+			found.MovieCount++
+		}
+	}
+
+	return found
+}
+
+// rewriteMovieGenres replaces the old slug on every movie with the new one, or drops it where the movie already has
+// the new one, bumping the versions of the movies it changes. The caller must hold the store mutex.
+func (s *memoryStore) rewriteMovieGenres(oldSlug, newSlug string) {
+	for id, movie := range s.movies {
+		if !containsAll(movie.Genres, []string{oldSlug}) {
+			continue
+		}
+
+		hasNew := containsAll(movie.Genres, []string{newSlug})
+
+		genres := []string{}
+		for _, genre := range movie.Genres {
+			switch {
+			case genre != oldSlug:
+				genres = append(genres, genre)
+			case !hasNew:
+				genres = append(genres, newSlug)
+			}
+		}
+
+		movie.Genres = genres
+		movie.Version++
+		s.movies[id] = movie
+	}
+}
+
+func (m memoryGenreModel) Insert(genre *Genre) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	err := m.store.genreConflict(genre)
+	if err != nil {
+		return err
+	}
+
+	m.store.genreSeq++
+	genre.ID = m.store.genreSeq
+	genre.CreatedAt = time.Now().Truncate(time.Second)
+	genre.Version = 1
+
+	m.store.genres[genre.ID] = copyGenre(*genre)
+
+	return nil
+}
+
+func (m memoryGenreModel) Get(id int64) (*Genre, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	genre, ok := m.store.genres[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	found := m.store.genreWithCount(genre)
+	return &found, nil
+}
+
+func (m memoryGenreModel) Update(genre *Genre) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current, ok := m.store.genres[genre.ID]
+	if !ok || current.Version != genre.Version {
+		return ErrEditConflict
+	}
+
+	if genre.Slug != current.Slug {
+		genre.Aliases = renamedAliases(genre.Aliases, current.Slug, genre.Slug)
+	}
+
+	err := m.store.genreConflict(genre)
+	if err != nil {
+		return err
+	}
+
+	if genre.Slug != current.Slug {
+		m.store.rewriteMovieGenres(current.Slug, genre.Slug)
+	}
+
+	genre.Version++
+	m.store.genres[genre.ID] = copyGenre(*genre)
+
+	return nil
+}
+
+func (m memoryGenreModel) Merge(sourceID, targetID int64) (*Genre, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	source, ok := m.store.genres[sourceID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	target, ok := m.store.genres[targetID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	m.store.rewriteMovieGenres(source.Slug, target.Slug)
+
+	delete(m.store.genres, source.ID)
+
+	target.Aliases = mergedAliases(&target, &source)
+	target.Version++
+	m.store.genres[target.ID] = copyGenre(target)
+
+	merged := m.store.genreWithCount(target)
+	return &merged, nil
+}
+
+func (m memoryGenreModel) GetAll(filters Filters) ([]*Genre, Metadata, error) {
+	m.store.mu.RLock()
+
+	matched := []Genre{}
+	for _, genre := range m.store.genres {
+		matched = append(matched, m.store.genreWithCount(genre))
+	}
+
+	m.store.mu.RUnlock()
+
+	column, desc := filters.sortColumn(), filters.sortDirection() == "DESC"
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := compareGenres(&matched[i], &matched[j], column)
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	totalRecords := len(matched)
+	start, end := pageBounds(totalRecords, filters)
+
+	genres := []*Genre{}
+	for i := start; i < end; i++ {
+		genres = append(genres, &matched[i])
+	}
+
+	return genres, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// compareGenres compares two genres on a sort column.
+func compareGenres(a, b *Genre, column string) int {
+	switch column {
+	case "id":
+		return compareInt64(a.ID, b.ID)
+	case "slug":
+		return strings.Compare(a.Slug, b.Slug)
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "movie_count":
+		return compareInt64(int64(a.MovieCount), int64(b.MovieCount))
+	}
+
+	panic("unsupported sort column: " + column)
+}
+
+func (m memoryGenreModel) Resolve(names []string) ([]string, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	resolved := []string{}
+
+	for _, name := range names {
+		slug := Slugify(name)
+
+		found := ""
+		for _, genre := range m.store.genres {
+			if genre.Slug == slug || containsAny(genre.Aliases, []string{slug}) {
+				found = genre.Slug
+				break
+			}
+		}
+
+		resolved = append(resolved, found)
+	}
+
+	return resolved, nil
+}
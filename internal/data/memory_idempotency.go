@@ -0,0 +1,85 @@
+package data
+
+import "time"
+
+type memoryIdempotencyModel struct {
+	store *memoryStore
+}
+
+// idempotencyKey identifies an idempotency record in the memory store.
+type idempotencyKey struct {
+	userID int64
+	key    string
+}
+
+func (m memoryIdempotencyModel) Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	id := idempotencyKey{record.UserID, record.Key}
+
+	if existing, ok := m.store.idempotency[id]; ok && existing.ExpiresAt.After(time.Now()) {
+		return &existing, nil
+	}
+
+	stored := *record
+	stored.Status, stored.Header, stored.Body = 0, nil, nil
+	m.store.idempotency[id] = stored
+
+	return nil, nil
+}
+
+func (m memoryIdempotencyModel) Complete(record *IdempotencyRecord) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	id := idempotencyKey{record.UserID, record.Key}
+
+	if _, ok := m.store.idempotency[id]; ok {
+		m.store.idempotency[id] = *record
+	}
+
+	return nil
+}
+
+func (m memoryIdempotencyModel) Renew(userID int64, key string, expiresAt time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	id := idempotencyKey{userID, key}
+
+	if existing, ok := m.store.idempotency[id]; ok && existing.Status == 0 {
+		existing.ExpiresAt = expiresAt
+		m.store.idempotency[id] = existing
+	}
+
+	return nil
+}
+
+func (m memoryIdempotencyModel) Release(userID int64, key string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	id := idempotencyKey{userID, key}
+
+	if existing, ok := m.store.idempotency[id]; ok && existing.Status == 0 {
+		delete(m.store.idempotency, id)
+	}
+
+	return nil
+}
+
+func (m memoryIdempotencyModel) DeleteExpired() error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	now := time.Now()
+
+	for id, record := range m.store.idempotency {
+		if !record.ExpiresAt.After(now) {
+			delete(m.store.idempotency, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package data
+
+type memoryImageModel struct {
+	store *memoryStore
+}
+
+// setImage replaces the images of a movie with a copy in which the image of the kind is set, or removed if image is
+// nil, and returns the image it replaced. The stored map is never modified, as snapshots of the store share it. The
+// caller must hold the store mutex.
+func (s *memoryStore) setImage(movieID int64, kind string, image *Image) *Image {
+	movie := s.movies[movieID]
+	prior := movie.Images[kind]
+
+	images := make(MovieImages, len(movie.Images)+1)
+	for k, v := range movie.Images {
+		images[k] = v
+	}
+
+	if image == nil {
+		delete(images, kind)
+	} else {
+		images[kind] = image
+	}
+
+	movie.Images = images
+	s.movies[movieID] = movie
+
+	return prior
+}
+
+func (m memoryImageModel) Set(movieID int64, kind string, image *Image) (*Image, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if !m.store.liveMovie(movieID) {
+		return nil, ErrRecordNotFound
+	}
+
+	stored := *image
+	return m.store.setImage(movieID, kind, &stored), nil
+}
+
+func (m memoryImageModel) Remove(movieID int64, kind string) (*Image, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if !m.store.liveMovie(movieID) || m.store.movies[movieID].Images[kind] == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.store.setImage(movieID, kind, nil), nil
+}
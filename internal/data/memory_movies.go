@@ -0,0 +1,739 @@
+package data
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type memoryMovieModel struct {
+	store *memoryStore
+}
+
+// copyMovie returns a copy of the movie which doesn't share its genres slice, translated titles, images or deletion
+// time with the original. The images themselves are never modified, so they are shared.
+func copyMovie(movie Movie) Movie {
+	movie.Genres = append([]string(nil), movie.Genres...)
+	movie.Titles = copyTitles(movie.Titles)
+	if movie.Images != nil {
+		images := make(MovieImages, len(movie.Images))
+		for kind, image := range movie.Images {
+			images[kind] = image
+		}
+		movie.Images = images
+	}
+	if movie.DeletedAt != nil {
+		deletedAt := *movie.DeletedAt
+		movie.DeletedAt = &deletedAt
+	}
+	return movie
+}
+
+func (m memoryMovieModel) Insert(movie *Movie) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	m.store.movieSeq++
+	movie.ID = m.store.movieSeq
+	movie.CreatedAt = time.Now().Truncate(time.Second)
+	movie.Version = 1
+
+	m.store.movies[movie.ID] = copyMovie(*movie)
+
+	return nil
+}
+
+func (m memoryMovieModel) Get(id int64) (*Movie, error) {
+	return m.get(id, false)
+}
+
+// GetFields reads every field of the movie, as GetAll ignores Filters.Fields.
+func (m memoryMovieModel) GetFields(id int64, fields []string) (*Movie, error) {
+	return m.get(id, false)
+}
+
+func (m memoryMovieModel) GetIncludingDeleted(id int64) (*Movie, error) {
+	return m.get(id, true)
+}
+
+func (m memoryMovieModel) get(id int64, includeDeleted bool) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	movie, ok := m.store.movies[id]
+	if !ok || (movie.DeletedAt != nil && !includeDeleted) {
+		return nil, ErrRecordNotFound
+	}
+
+	found := copyMovie(movie)
+	return &found, nil
+}
+
+func (m memoryMovieModel) Missing(ids []int64) ([]int64, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	missing := []int64{}
+	for _, id := range ids {
+		if movie, ok := m.store.movies[id]; !ok || movie.DeletedAt != nil {
+			missing = append(missing, id)
+		}
+	}
+
+	return missing, nil
+}
+
+func (m memoryMovieModel) GetAllForGenre(slug string) ([]*Movie, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	movies := []*Movie{}
+	for _, movie := range m.store.movies {
+		if containsAll(movie.Genres, []string{slug}) {
+			found := copyMovie(movie)
+			movies = append(movies, &found)
+		}
+	}
+
+	sort.Slice(movies, func(i, j int) bool {
+		return movies[i].ID < movies[j].ID
+	})
+
+	return movies, nil
+}
+
+func (m memoryMovieModel) Update(movie *Movie) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current, ok := m.store.movies[movie.ID]
+	if !ok || current.Version != movie.Version || current.DeletedAt != nil {
+		return ErrEditConflict
+	}
+
+	movie.Version++
+
+	// The rating aggregates and images belong to the rating and image models, so keep the stored values.
+	updated := copyMovie(*movie)
+	updated.RatingAverage, updated.RatingCount = current.RatingAverage, current.RatingCount
+	updated.Images = current.Images
+	m.store.movies[movie.ID] = updated
+
+	return nil
+}
+
+func (m memoryMovieModel) Delete(movie *Movie) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current, ok := m.store.movies[movie.ID]
+	if !ok || current.Version != movie.Version || current.DeletedAt != nil {
+		return ErrEditConflict
+	}
+
+	deletedAt := time.Now().Truncate(time.Second)
+	current.DeletedAt = &deletedAt
+	current.Version++
+	m.store.movies[movie.ID] = current
+
+	movie.Version = current.Version
+	movie.DeletedAt = &deletedAt
+
+	return nil
+}
+
+func (m memoryMovieModel) GetAllDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	m.store.mu.RLock()
+
+	deleted := []Movie{}
+	for _, movie := range m.store.movies {
+		if movie.DeletedAt != nil {
+			deleted = append(deleted, copyMovie(movie))
+		}
+	}
+
+	m.store.mu.RUnlock()
+
+	sortMovies(deleted, filters)
+
+	movies, totalRecords := paginate(deleted, filters)
+
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m memoryMovieModel) Restore(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	movie, ok := m.store.movies[id]
+	if !ok || movie.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	movie.DeletedAt = nil
+	movie.Version++
+	m.store.movies[id] = movie
+
+	restored := copyMovie(movie)
+	return &restored, nil
+}
+
+func (m memoryMovieModel) Purge(deletedBefore time.Time) ([]*Movie, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	purged := []*Movie{}
+	for id, movie := range m.store.movies {
+		if movie.DeletedAt != nil && movie.DeletedAt.Before(deletedBefore) {
+			// The revisions, credits, ratings, watchlist items, collection places and redirects of a movie are removed
+			// along with it, like ON DELETE CASCADE.
+			delete(m.store.movies, id)
+			delete(m.store.revisions, id)
+			delete(m.store.credits, id)
+			delete(m.store.ratings, id)
+			for _, items := range m.store.watchlist {
+				delete(items, id)
+			}
+			m.store.removeCollectionMovie(id)
+			for sourceID, targetID := range m.store.redirects {
+				if targetID == id {
+					delete(m.store.redirects, sourceID)
+				}
+			}
+			purged = append(purged, &Movie{ID: movie.ID, Title: movie.Title, Images: movie.Images})
+		}
+	}
+
+	return purged, nil
+}
+
+func (m memoryMovieModel) GetAll(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error) {
+	matched := m.matching(filter, filters)
+
+	if c, ok := filters.cursor(); ok {
+		pivot := cursorMovie(c, filters.sortColumn())
+
+		// Collect the rows on the requested side of the cursor, nearest first, plus one extra row to find out
+		// whether another page follows.
+		page := []*Movie{}
+		if c.Backward {
+			for i := len(matched) - 1; i >= 0 && len(page) <= filters.limit(); i-- {
+				if movieLess(&matched[i], &pivot, filters) {
+					page = append(page, &matched[i])
+				}
+			}
+		} else {
+			for i := 0; i < len(matched) && len(page) <= filters.limit(); i++ {
+				if movieLess(&pivot, &matched[i], filters) {
+					page = append(page, &matched[i])
+				}
+			}
+		}
+
+		movies, metadata := keysetPage(page, filters, c)
+		return movies, metadata, nil
+	}
+
+	movies, totalRecords := paginate(matched, filters)
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	movieCursors(&metadata, filters, movies, filters.Page > 1, filters.offset()+len(movies) < totalRecords)
+
+	return movies, metadata, nil
+}
+
+// paginate returns the page of sorted movies selected by the filters' LIMIT and OFFSET, along with the total number
+// of movies.
+func paginate(sorted []Movie, filters Filters) ([]*Movie, int) {
+	totalRecords := len(sorted)
+	start, end := pageBounds(totalRecords, filters)
+
+	movies := []*Movie{}
+	for i := start; i < end; i++ {
+		movies = append(movies, &sorted[i])
+	}
+
+	return movies, totalRecords
+}
+
+// pageBounds returns the range of indexes selected by the filters' LIMIT and OFFSET from a sorted slice of the given
+// length.
+func pageBounds(length int, filters Filters) (start, end int) {
+	start = filters.offset()
+	if start > length {
+		start = length
+	}
+	end = start + filters.limit()
+	if end > length {
+		end = length
+	}
+	return start, end
+}
+
+func (m memoryMovieModel) ForEach(filter MovieFilter, filters Filters, fn func(movie *Movie) error) error {
+	matched := m.matching(filter, filters)
+
+	for i := range matched {
+		err := fn(&matched[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m memoryMovieModel) Facets(filter MovieFilter, facets []string) (Facets, error) {
+	matched := m.matching(filter, Filters{Sort: "id", SortSafelist: []string{"id"}})
+
+	result := make(Facets, len(facets))
+
+	for _, facet := range facets {
+		counts := make(map[string]int)
+		var values []string
+
+		count := func(value string) {
+			if counts[value] == 0 {
+				values = append(values, value)
+			}
+			counts[value]++
+		}
+
+		for _, movie := range matched {
+			switch facet {
+			case FacetGenres:
+				for _, genre := range movie.Genres {
+					count(genre)
+				}
+			case FacetDecade:
+				count(decade(movie.Year))
+			case FacetDurationBucket:
+				count(durationBucket(movie.Duration))
+			default:
+				panic("unsupported facet: " + facet)
+			}
+		}
+
+		// Order the values the same way as facetQuery().
+		switch facet {
+		case FacetGenres:
+			sort.Slice(values, func(i, j int) bool {
+				if counts[values[i]] != counts[values[j]] {
+					return counts[values[i]] > counts[values[j]]
+				}
+				return values[i] < values[j]
+			})
+		case FacetDecade:
+			// Every decade since 1880 has four digits, so the labels sort as strings.
+			sort.Strings(values)
+		case FacetDurationBucket:
+			sort.Slice(values, func(i, j int) bool {
+				return durationBucketIndex(values[i]) < durationBucketIndex(values[j])
+			})
+		}
+
+		result[facet] = []FacetCount{}
+		for _, value := range values {
+			result[facet] = append(result[facet], FacetCount{Value: value, Count: counts[value]})
+		}
+	}
+
+	return result, nil
+}
+
+func (m memoryMovieModel) Suggest(prefix string, limit int) ([]*Suggestion, error) {
+	m.store.mu.RLock()
+
+	type candidate struct {
+		movie  Movie
+		title  string
+		starts bool
+	}
+
+	candidates := []candidate{}
+	for _, movie := range m.store.movies {
+		if movie.DeletedAt != nil {
+			continue
+		}
+		title, starts := suggestedTitle(movie.Title, movie.Titles, prefix)
+		if starts || matchesWordPrefixes(movieSearchTitles(&movie), prefix) {
+			candidates = append(candidates, candidate{movie: movie, title: title, starts: starts})
+		}
+	}
+
+	m.store.mu.RUnlock()
+
+	// Order the candidates the same way as MovieModel.Suggest().
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case a.starts != b.starts:
+			return a.starts
+		case a.movie.RatingCount != b.movie.RatingCount:
+			return a.movie.RatingCount > b.movie.RatingCount
+		case a.movie.Title != b.movie.Title:
+			return a.movie.Title < b.movie.Title
+		}
+		return a.movie.ID < b.movie.ID
+	})
+
+	suggestions := []*Suggestion{}
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		movie := candidates[i].movie
+		suggestions = append(suggestions, &Suggestion{ID: movie.ID, Title: candidates[i].title, Year: movie.Year})
+	}
+
+	return suggestions, nil
+}
+
+// durationBucketIndex returns the position of a duration bucket label in durationBuckets.
+func durationBucketIndex(label string) int {
+	for i, b := range durationBuckets {
+		if b.label == label {
+			return i
+		}
+	}
+	return len(durationBuckets)
+}
+
+// matching returns copies of the movies matching the filter, ordered by the filters' sort.
+func (m memoryMovieModel) matching(filter MovieFilter, filters Filters) []Movie {
+	m.store.mu.RLock()
+
+	matched := []Movie{}
+	for _, movie := range m.store.movies {
+		if movie.DeletedAt != nil || !matchesFilter(&movie, filter) {
+			continue
+		}
+		if !m.store.credited(movie.ID, filter.Director, RoleDirector) || !m.store.credited(movie.ID, filter.Actor, RoleActor) {
+			continue
+		}
+		if !m.store.inCollection(movie.ID, filter.Collection) {
+			continue
+		}
+		found := copyMovie(movie)
+		found.relevance = -titleRelevance(&movie, filter)
+		matched = append(matched, found)
+	}
+
+	m.store.mu.RUnlock()
+
+	sortMovies(matched, filters)
+
+	return matched
+}
+
+// cursorMovie builds a movie holding the sort key and id recorded in a cursor, so that it can be compared with real
+// rows. The key has already been checked by decodeCursor().
+func cursorMovie(c cursor, column string) Movie {
+	movie := Movie{ID: c.ID}
+
+	n, _ := strconv.ParseInt(c.Key, 10, 64)
+
+	switch column {
+	case "id":
+		movie.ID = n
+	case "title":
+		movie.Title = c.Key
+	case "year":
+		movie.Year = int32(n)
+	case "duration":
+		movie.Duration = int32(n)
+	case "rating_average":
+		movie.RatingAverage, _ = strconv.ParseFloat(c.Key, 64)
+	case "rating_count":
+		movie.RatingCount = int32(n)
+	case "relevance":
+		movie.relevance, _ = strconv.ParseFloat(c.Key, 64)
+	}
+
+	return movie
+}
+
+// matchesFilter mirrors the conditions of movieConditions on the columns of the movie itself. The credit conditions
+// are checked separately against the store.
+func matchesFilter(movie *Movie, f MovieFilter) bool {
+	switch {
+	case f.Fuzzy && !matchesTitleFuzzy(movieSearchTitles(movie), f.Title):
+		return false
+	case !f.Fuzzy && !matchesTitle(movieSearchTitles(movie), f.Title):
+		return false
+	case !containsAll(movie.Genres, f.Genres):
+		return false
+	case len(f.GenresAny) > 0 && !containsAny(movie.Genres, f.GenresAny):
+		return false
+	case f.YearMin != 0 && movie.Year < f.YearMin, f.YearMax != 0 && movie.Year > f.YearMax:
+		return false
+	case f.DurationMin != 0 && movie.Duration < f.DurationMin, f.DurationMax != 0 && movie.Duration > f.DurationMax:
+		return false
+	case !f.CreatedAfter.IsZero() && movie.CreatedAt.Before(f.CreatedAfter):
+		return false
+	case !f.CreatedBefore.IsZero() && !movie.CreatedAt.Before(f.CreatedBefore):
+		return false
+	}
+
+	return true
+}
+
+// lexemes splits text into lower-cased words, approximating to_tsvector('simple', ...).
+func lexemes(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchesTitle mirrors to_tsvector('simple', title) @@ plainto_tsquery('simple', query): every word of the query must
+// appear as a word of the title. An empty query matches everything.
+func matchesTitle(title, query string) bool {
+	if query == "" {
+		return true
+	}
+
+	words := lexemes(query)
+	if len(words) == 0 {
+		return false
+	}
+
+	return containsAll(lexemes(title), words)
+}
+
+// wordSimilarityThreshold is the default pg_trgm.word_similarity_threshold, above which the <% operator matches.
+const wordSimilarityThreshold = 0.6
+
+// matchesTitleFuzzy mirrors the title condition of a fuzzy MovieFilter: the query must either be similar enough to a
+// run of words of the title, or every word of the query must begin a word of the title.
+func matchesTitleFuzzy(title, query string) bool {
+	if query == "" {
+		return true
+	}
+
+	if wordSimilarity(query, title) >= wordSimilarityThreshold {
+		return true
+	}
+
+	return matchesWordPrefixes(title, query)
+}
+
+// matchesWordPrefixes mirrors to_tsvector('simple', title) @@ prefixQuery(query): every word of the query must begin
+// a word of the title.
+func matchesWordPrefixes(title, query string) bool {
+	words := lexemes(query)
+	if len(words) == 0 {
+		return false
+	}
+
+	titleWords := lexemes(title)
+	for _, w := range words {
+		found := false
+		for _, t := range titleWords {
+			if strings.HasPrefix(t, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// titleRelevance scores how well a movie's titles match the filter's title, standing in for MovieFilter.relevance().
+// Trigram similarity is used for both kinds of search, as there is no in-memory ts_rank().
+func titleRelevance(movie *Movie, f MovieFilter) float64 {
+	if f.Title == "" {
+		return 0
+	}
+
+	score := similarity(movie.Title, f.Title)
+	for _, title := range movie.Titles {
+		if s := similarity(title, f.Title); s > score {
+			score = s
+		}
+	}
+	if f.Fuzzy {
+		if ws := wordSimilarity(f.Title, movieSearchTitles(movie)); ws > score {
+			score = ws
+		}
+	}
+	return score
+}
+
+// trigrams returns the set of trigrams of the words, each word padded as pg_trgm pads them with two spaces in front
+// and one behind.
+func trigrams(words []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range words {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// similarity mirrors pg_trgm's similarity(): the trigrams the texts share, as a fraction of all of their trigrams.
+func similarity(a, b string) float64 {
+	x, y := trigrams(lexemes(a)), trigrams(lexemes(b))
+
+	shared := 0
+	for t := range x {
+		if y[t] {
+			shared++
+		}
+	}
+
+	if all := len(x) + len(y) - shared; all > 0 {
+		return float64(shared) / float64(all)
+	}
+	return 0
+}
+
+// wordSimilarity approximates pg_trgm's word_similarity(): the greatest fraction of the query's trigrams found in any
+// run of consecutive words of the text.
+func wordSimilarity(query, text string) float64 {
+	q := trigrams(lexemes(query))
+	if len(q) == 0 {
+		return 0
+	}
+
+	words := lexemes(text)
+
+	best := 0
+	for i := range words {
+		for j := i + 1; j <= len(words); j++ {
+			run := trigrams(words[i:j])
+
+			shared := 0
+			for t := range q {
+				if run[t] {
+					shared++
+				}
+			}
+			if shared > best {
+				best = shared
+			}
+		}
+	}
+
+	return float64(best) / float64(len(q))
+}
+
+// containsAll mirrors the PostgreSQL array containment operator (values @> wanted).
+func containsAll(values, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, v := range values {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// containsAny mirrors the PostgreSQL array overlap operator (values && wanted).
+func containsAny(values, wanted []string) bool {
+	for _, w := range wanted {
+		for _, v := range values {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareMovies compares two movies on a sort column, returning a negative number, zero or a positive number.
+func compareMovies(a, b *Movie, column string) int {
+	switch column {
+	case "id":
+		return compareInt64(a.ID, b.ID)
+	case "title":
+		return strings.Compare(a.Title, b.Title)
+	case "year":
+		return compareInt64(int64(a.Year), int64(b.Year))
+	case "duration":
+		return compareInt64(int64(a.Duration), int64(b.Duration))
+	case "rating_average":
+		return compareFloat64(a.RatingAverage, b.RatingAverage)
+	case "rating_count":
+		return compareInt64(int64(a.RatingCount), int64(b.RatingCount))
+	case "relevance":
+		return compareFloat64(a.relevance, b.relevance)
+	case "deleted_at":
+		return compareTimes(a.DeletedAt, b.DeletedAt)
+	}
+
+	panic("unsupported sort column: " + column)
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareTimes compares two nullable timestamps, sorting NULL last like PostgreSQL does in ascending order.
+func compareTimes(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	}
+	return 0
+}
+
+// movieLess reports whether a sorts before b in the ORDER BY clause of MovieModel.GetAll(): by the sort column in the
+// requested direction, then by ascending id.
+func movieLess(a, b *Movie, filters Filters) bool {
+	c := compareMovies(a, b, filters.sortColumn())
+	if filters.sortDirection() == "DESC" {
+		c = -c
+	}
+	if c != 0 {
+		return c < 0
+	}
+	return a.ID < b.ID
+}
+
+func sortMovies(movies []Movie, filters Filters) {
+	sort.SliceStable(movies, func(i, j int) bool {
+		return movieLess(&movies[i], &movies[j], filters)
+	})
+}
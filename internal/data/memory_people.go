@@ -0,0 +1,297 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryPersonModel struct {
+	store *memoryStore
+}
+
+// copyPerson returns a copy of the person which doesn't share its aliases slice with the original.
+func copyPerson(person Person) Person {
+	person.Aliases = append([]string{}, person.Aliases...)
+	return person
+}
+
+func (m memoryPersonModel) Insert(person *Person) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	m.store.personSeq++
+	person.ID = m.store.personSeq
+	person.CreatedAt = time.Now().Truncate(time.Second)
+	person.Version = 1
+
+	m.store.people[person.ID] = copyPerson(*person)
+
+	return nil
+}
+
+func (m memoryPersonModel) Get(id int64) (*Person, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	person, ok := m.store.people[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	found := copyPerson(person)
+	return &found, nil
+}
+
+func (m memoryPersonModel) Update(person *Person) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current, ok := m.store.people[person.ID]
+	if !ok || current.Version != person.Version {
+		return ErrEditConflict
+	}
+
+	person.Version++
+	m.store.people[person.ID] = copyPerson(*person)
+
+	return nil
+}
+
+func (m memoryPersonModel) Delete(id int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.people[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.store.people, id)
+
+	// The credits of a person are removed along with them, like ON DELETE CASCADE.
+	for movieID, credits := range m.store.credits {
+		kept := []Credit{}
+		for _, credit := range credits {
+			if credit.PersonID != id {
+				kept = append(kept, credit)
+			}
+		}
+		m.store.credits[movieID] = kept
+	}
+
+	return nil
+}
+
+func (m memoryPersonModel) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	m.store.mu.RLock()
+
+	matched := []Person{}
+	for _, person := range m.store.people {
+		if matchesName(person, name) {
+			matched = append(matched, copyPerson(person))
+		}
+	}
+
+	m.store.mu.RUnlock()
+
+	column, desc := filters.sortColumn(), filters.sortDirection() == "DESC"
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := comparePeople(&matched[i], &matched[j], column)
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	totalRecords := len(matched)
+	start, end := pageBounds(totalRecords, filters)
+
+	people := []*Person{}
+	for i := start; i < end; i++ {
+		people = append(people, &matched[i])
+	}
+
+	return people, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// matchesName reports whether the person's name or one of their aliases contains the text, ignoring case.
+func matchesName(person Person, text string) bool {
+	if text == "" {
+		return true
+	}
+
+	text = strings.ToLower(text)
+
+	for _, name := range append([]string{person.Name}, person.Aliases...) {
+		if strings.Contains(strings.ToLower(name), text) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// comparePeople compares two people on a sort column. An unknown birth year sorts like NULL does in PostgreSQL.
+func comparePeople(a, b *Person, column string) int {
+	switch column {
+	case "id":
+		return compareInt64(a.ID, b.ID)
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "birth_year":
+		switch {
+		case a.BirthYear == 0 && b.BirthYear == 0:
+			return 0
+		case a.BirthYear == 0:
+			return 1
+		case b.BirthYear == 0:
+			return -1
+		}
+		return compareInt64(int64(a.BirthYear), int64(b.BirthYear))
+	}
+
+	panic("unsupported sort column: " + column)
+}
+
+type memoryCreditModel struct {
+	store *memoryStore
+}
+
+// credited reports whether a movie credits the person in the role. A zero person id matches every movie. The caller
+// must hold the store mutex.
+func (s *memoryStore) credited(movieID, personID int64, role string) bool {
+	if personID == 0 {
+		return true
+	}
+
+	for _, credit := range s.credits[movieID] {
+		if credit.PersonID == personID && credit.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m memoryCreditModel) GetAllForMovie(movieID int64) ([]*Credit, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	credits := []*Credit{}
+	for _, credit := range m.store.credits[movieID] {
+		credit := credit
+		credit.PersonName = m.store.people[credit.PersonID].Name
+		credits = append(credits, &credit)
+	}
+
+	sort.SliceStable(credits, func(i, j int) bool {
+		if credits[i].BillingOrder != credits[j].BillingOrder {
+			return credits[i].BillingOrder < credits[j].BillingOrder
+		}
+		return credits[i].ID < credits[j].ID
+	})
+
+	return credits, nil
+}
+
+func (m memoryCreditModel) GetAllForMovies(movieIDs []int64) (map[int64][]*Credit, error) {
+	credits := make(map[int64][]*Credit, len(movieIDs))
+
+	for _, id := range movieIDs {
+		forMovie, err := m.GetAllForMovie(id)
+		if err != nil {
+			return nil, err
+		}
+		credits[id] = forMovie
+	}
+
+	return credits, nil
+}
+
+func (m memoryCreditModel) GetAllForPerson(personID int64, filters Filters) ([]*Credit, Metadata, error) {
+	m.store.mu.RLock()
+
+	type filmographyRow struct {
+		credit Credit
+		movie  Movie
+	}
+
+	rows := []filmographyRow{}
+	for movieID, credits := range m.store.credits {
+		movie, ok := m.store.movies[movieID]
+		if !ok || movie.DeletedAt != nil {
+			continue
+		}
+
+		for _, credit := range credits {
+			if credit.PersonID == personID {
+				credit.MovieTitle = movie.Title
+				credit.MovieYear = movie.Year
+				rows = append(rows, filmographyRow{credit: credit, movie: movie})
+			}
+		}
+	}
+
+	m.store.mu.RUnlock()
+
+	column, desc := filters.sortColumn(), filters.sortDirection() == "DESC"
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		c := compareMovies(&rows[i].movie, &rows[j].movie, column)
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return rows[i].credit.ID < rows[j].credit.ID
+	})
+
+	totalRecords := len(rows)
+	start, end := pageBounds(totalRecords, filters)
+
+	credits := []*Credit{}
+	for i := start; i < end; i++ {
+		credits = append(credits, &rows[i].credit)
+	}
+
+	return credits, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m memoryCreditModel) ReplaceForMovie(movieID int64, credits []*Credit) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	// credits references both movies and people, so credits for unknown rows are rejected.
+	if _, ok := m.store.movies[movieID]; !ok {
+		return ErrRecordNotFound
+	}
+	for _, credit := range credits {
+		if _, ok := m.store.people[credit.PersonID]; !ok {
+			return ErrRecordNotFound
+		}
+	}
+
+	stored := []Credit{}
+	for _, credit := range credits {
+		m.store.creditSeq++
+		credit.ID = m.store.creditSeq
+		credit.MovieID = movieID
+
+		row := *credit
+		row.PersonName, row.MovieTitle, row.MovieYear = "", "", 0
+		stored = append(stored, row)
+	}
+
+	m.store.credits[movieID] = stored
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+type memoryRatingModel struct {
+	store *memoryStore
+}
+
+// updateAggregates recalculates the rating aggregates stored on a movie. The caller must hold the store mutex.
+func (s *memoryStore) updateAggregates(movieID int64) {
+	movie := s.movies[movieID]
+
+	var sum int64
+	for _, rating := range s.ratings[movieID] {
+		sum += int64(rating.Score)
+	}
+
+	movie.RatingCount = int32(len(s.ratings[movieID]))
+	movie.RatingAverage = 0
+	if movie.RatingCount > 0 {
+		movie.RatingAverage = float64(sum) / float64(movie.RatingCount)
+	}
+
+	s.movies[movieID] = movie
+}
+
+// liveMovie reports whether a movie exists and is not in the trash. The caller must hold the store mutex.
+func (s *memoryStore) liveMovie(movieID int64) bool {
+	movie, ok := s.movies[movieID]
+	return ok && movie.DeletedAt == nil
+}
+
+func (m memoryRatingModel) Set(rating *Rating) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if !m.store.liveMovie(rating.MovieID) {
+		return ErrRecordNotFound
+	}
+
+	now := time.Now().Truncate(time.Second)
+
+	ratings := m.store.ratings[rating.MovieID]
+	if ratings == nil {
+		ratings = make(map[int64]Rating)
+		m.store.ratings[rating.MovieID] = ratings
+	}
+
+	rating.CreatedAt = now
+	if current, ok := ratings[rating.UserID]; ok {
+		rating.CreatedAt = current.CreatedAt
+	}
+	rating.UpdatedAt = now
+
+	stored := *rating
+	stored.MovieTitle = ""
+	ratings[rating.UserID] = stored
+
+	m.store.updateAggregates(rating.MovieID)
+
+	return nil
+}
+
+func (m memoryRatingModel) Delete(userID, movieID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if !m.store.liveMovie(movieID) {
+		return ErrRecordNotFound
+	}
+
+	if _, ok := m.store.ratings[movieID][userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.store.ratings[movieID], userID)
+
+	m.store.updateAggregates(movieID)
+
+	return nil
+}
+
+func (m memoryRatingModel) Get(userID, movieID int64) (*Rating, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	rating, ok := m.store.ratings[movieID][userID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return &rating, nil
+}
+
+func (m memoryRatingModel) GetAllForUser(userID int64, filters Filters) ([]*Rating, Metadata, error) {
+	m.store.mu.RLock()
+
+	matched := []Rating{}
+	for movieID, ratings := range m.store.ratings {
+		rating, ok := ratings[userID]
+		if !ok || !m.store.liveMovie(movieID) {
+			continue
+		}
+		rating.MovieTitle = m.store.movies[movieID].Title
+		matched = append(matched, rating)
+	}
+
+	m.store.mu.RUnlock()
+
+	column, desc := filters.sortColumn(), filters.sortDirection() == "DESC"
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := compareRatings(&matched[i], &matched[j], column)
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return matched[i].MovieID < matched[j].MovieID
+	})
+
+	totalRecords := len(matched)
+	start, end := pageBounds(totalRecords, filters)
+
+	ratings := []*Rating{}
+	for i := start; i < end; i++ {
+		ratings = append(ratings, &matched[i])
+	}
+
+	return ratings, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// compareRatings compares two ratings on a sort column.
+func compareRatings(a, b *Rating, column string) int {
+	switch column {
+	case "score":
+		return compareInt64(int64(a.Score), int64(b.Score))
+	case "created_at":
+		return compareTimes(&a.CreatedAt, &b.CreatedAt)
+	case "updated_at":
+		return compareTimes(&a.UpdatedAt, &b.UpdatedAt)
+	}
+
+	panic("unsupported sort column: " + column)
+}
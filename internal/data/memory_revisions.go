@@ -0,0 +1,93 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+type memoryRevisionModel struct {
+	store *memoryStore
+}
+
+// copyRevision returns a copy of the revision which doesn't share its snapshots with the original.
+func copyRevision(rev Revision) Revision {
+	if rev.Prior != nil {
+		prior := *rev.Prior
+		prior.Genres = append([]string(nil), prior.Genres...)
+		rev.Prior = &prior
+	}
+	rev.State.Genres = append([]string(nil), rev.State.Genres...)
+	return rev
+}
+
+func (m memoryRevisionModel) Insert(rev *Revision) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	// movie_revisions references movies, so a revision for an unknown movie is rejected.
+	if _, ok := m.store.movies[rev.MovieID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	m.store.revisionSeq++
+	rev.ID = m.store.revisionSeq
+	rev.CreatedAt = time.Now().Truncate(time.Second)
+
+	m.store.revisions[rev.MovieID] = append(m.store.revisions[rev.MovieID], copyRevision(*rev))
+
+	return nil
+}
+
+func (m memoryRevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*Revision, Metadata, error) {
+	m.store.mu.RLock()
+
+	revisions := []Revision{}
+	for _, rev := range m.store.revisions[movieID] {
+		revisions = append(revisions, copyRevision(rev))
+	}
+
+	m.store.mu.RUnlock()
+
+	descending := filters.sortDirection() == "DESC"
+
+	sort.SliceStable(revisions, func(i, j int) bool {
+		a, b := revisions[i], revisions[j]
+		if a.Version != b.Version {
+			return (a.Version < b.Version) != descending
+		}
+		return a.ID < b.ID
+	})
+
+	totalRecords := len(revisions)
+
+	start := filters.offset()
+	if start > totalRecords {
+		start = totalRecords
+	}
+	end := start + filters.limit()
+	if end > totalRecords {
+		end = totalRecords
+	}
+
+	page := []*Revision{}
+	for i := start; i < end; i++ {
+		page = append(page, &revisions[i])
+	}
+
+	return page, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+func (m memoryRevisionModel) Get(movieID int64, version int32) (*Revision, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	revisions := m.store.revisions[movieID]
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if revisions[i].Version == version && revisions[i].MergedFrom == 0 {
+			rev := copyRevision(revisions[i])
+			return &rev, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
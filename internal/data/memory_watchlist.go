@@ -0,0 +1,208 @@
+package data
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type memoryWatchlistModel struct {
+	store *memoryStore
+}
+
+// copyWatchlistItem returns a copy of the item which doesn't share its watched date with the original.
+func copyWatchlistItem(item WatchlistItem) WatchlistItem {
+	if item.WatchedOn != nil {
+		watchedOn := *item.WatchedOn
+		item.WatchedOn = &watchedOn
+	}
+	item.Movie = nil
+	return item
+}
+
+// lastPosition returns the highest position on a user's watchlist. The caller must hold the store mutex.
+func (s *memoryStore) lastPosition(userID int64) int32 {
+	var last int32
+	for _, item := range s.watchlist[userID] {
+		if item.Position > last {
+			last = item.Position
+		}
+	}
+	return last
+}
+
+// shiftPositions adds delta to the position of every item on a user's watchlist between from and to inclusive. The
+// caller must hold the store mutex.
+func (s *memoryStore) shiftPositions(userID int64, from, to, delta int32) {
+	for movieID, item := range s.watchlist[userID] {
+		if item.Position >= from && item.Position <= to {
+			item.Position += delta
+			s.watchlist[userID][movieID] = item
+		}
+	}
+}
+
+func (m memoryWatchlistModel) Add(item *WatchlistItem) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.users[item.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	if !m.store.liveMovie(item.MovieID) {
+		return ErrRecordNotFound
+	}
+
+	if _, ok := m.store.watchlist[item.UserID][item.MovieID]; ok {
+		return ErrDuplicateWatchlistItem
+	}
+
+	last := m.store.lastPosition(item.UserID)
+	item.Position = clampPosition(item.Position, last+1)
+	m.store.shiftPositions(item.UserID, item.Position, last, 1)
+
+	item.AddedAt = time.Now().Truncate(time.Second)
+
+	if m.store.watchlist[item.UserID] == nil {
+		m.store.watchlist[item.UserID] = make(map[int64]WatchlistItem)
+	}
+	m.store.watchlist[item.UserID][item.MovieID] = copyWatchlistItem(*item)
+
+	return nil
+}
+
+func (m memoryWatchlistModel) Update(item *WatchlistItem) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	current, ok := m.store.watchlist[item.UserID][item.MovieID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	item.Position = clampPosition(item.Position, m.store.lastPosition(item.UserID))
+
+	if item.Position < current.Position {
+		m.store.shiftPositions(item.UserID, item.Position, current.Position-1, 1)
+	} else if item.Position > current.Position {
+		m.store.shiftPositions(item.UserID, current.Position+1, item.Position, -1)
+	}
+
+	current.Position = item.Position
+	current.WatchedOn = item.WatchedOn
+	m.store.watchlist[item.UserID][item.MovieID] = copyWatchlistItem(current)
+
+	return nil
+}
+
+func (m memoryWatchlistModel) Remove(userID, movieID int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	item, ok := m.store.watchlist[userID][movieID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.store.watchlist[userID], movieID)
+	m.store.shiftPositions(userID, item.Position+1, m.store.lastPosition(userID), -1)
+
+	return nil
+}
+
+// watchlistItem returns a copy of an item along with a copy of its movie, or false if it is hidden because the movie
+// is in the trash. The caller must hold the store mutex.
+func (s *memoryStore) watchlistItem(item WatchlistItem) (WatchlistItem, bool) {
+	if !s.liveMovie(item.MovieID) {
+		return WatchlistItem{}, false
+	}
+
+	found := copyWatchlistItem(item)
+	movie := copyMovie(s.movies[item.MovieID])
+	found.Movie = &movie
+
+	return found, true
+}
+
+func (m memoryWatchlistModel) Get(userID, movieID int64) (*WatchlistItem, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	item, ok := m.store.watchlist[userID][movieID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	found, ok := m.store.watchlistItem(item)
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return &found, nil
+}
+
+func (m memoryWatchlistModel) GetAllForUser(userID int64, watched *bool, filters Filters) ([]*WatchlistItem, Metadata, error) {
+	m.store.mu.RLock()
+
+	matched := []WatchlistItem{}
+	for _, item := range m.store.watchlist[userID] {
+		if watched != nil && (item.WatchedOn != nil) != *watched {
+			continue
+		}
+		if found, ok := m.store.watchlistItem(item); ok {
+			matched = append(matched, found)
+		}
+	}
+
+	m.store.mu.RUnlock()
+
+	column, desc := filters.sortColumn(), filters.sortDirection() == "DESC"
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := compareWatchlistItems(&matched[i], &matched[j], column)
+		if desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return matched[i].Position < matched[j].Position
+	})
+
+	totalRecords := len(matched)
+	start, end := pageBounds(totalRecords, filters)
+
+	items := []*WatchlistItem{}
+	for i := start; i < end; i++ {
+		items = append(items, &matched[i])
+	}
+
+	return items, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// compareWatchlistItems compares two watchlist items on a sort column. An item which hasn't been watched sorts like
+// a NULL watched_on does in PostgreSQL.
+func compareWatchlistItems(a, b *WatchlistItem, column string) int {
+	switch column {
+	case "position":
+		return compareInt64(int64(a.Position), int64(b.Position))
+	case "added_at":
+		return compareTimes(&a.AddedAt, &b.AddedAt)
+	case "watched_on":
+		var x, y *time.Time
+		if a.WatchedOn != nil {
+			x = &a.WatchedOn.Time
+		}
+		if b.WatchedOn != nil {
+			y = &b.WatchedOn.Time
+		}
+		return compareTimes(x, y)
+	case "title":
+		return strings.Compare(a.Movie.Title, b.Movie.Title)
+	case "year":
+		return compareInt64(int64(a.Movie.Year), int64(b.Movie.Year))
+	}
+
+	panic("unsupported sort column: " + column)
+}
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -10,29 +12,215 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// DBTX is satisfied by both *sql.DB and *sql.Tx, so the PostgreSQL models can run inside or outside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// MovieStore is implemented by every backend which can persist movies.
+type MovieStore interface {
+	Insert(movie *Movie) error
+	Get(id int64) (*Movie, error)
+	GetFields(id int64, fields []string) (*Movie, error)
+	GetIncludingDeleted(id int64) (*Movie, error)
+	Update(movie *Movie) error
+	Delete(movie *Movie) error
+	GetAll(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error)
+	ForEach(filter MovieFilter, filters Filters, fn func(movie *Movie) error) error
+	Facets(filter MovieFilter, facets []string) (Facets, error)
+	Suggest(prefix string, limit int) ([]*Suggestion, error)
+	GetAllDeleted(filters Filters) ([]*Movie, Metadata, error)
+	Restore(id int64) (*Movie, error)
+	Purge(deletedBefore time.Time) ([]*Movie, error)
+	FindDuplicates(title string, year int32) ([]*Movie, error)
+	GetAllForGenre(slug string) ([]*Movie, error)
+	Missing(ids []int64) ([]int64, error)
+	Merge(source, target *Movie) ([]*Image, error)
+	Redirect(id int64) (int64, error)
+}
+
+// RevisionStore is implemented by every backend which can persist the revision history of movies.
+type RevisionStore interface {
+	Insert(rev *Revision) error
+	GetAllForMovie(movieID int64, filters Filters) ([]*Revision, Metadata, error)
+	Get(movieID int64, version int32) (*Revision, error)
+}
+
+// PersonStore is implemented by every backend which can persist people.
+type PersonStore interface {
+	Insert(person *Person) error
+	Get(id int64) (*Person, error)
+	Update(person *Person) error
+	Delete(id int64) error
+	GetAll(name string, filters Filters) ([]*Person, Metadata, error)
+}
+
+// CreditStore is implemented by every backend which can persist the credits linking people to movies.
+type CreditStore interface {
+	GetAllForMovie(movieID int64) ([]*Credit, error)
+	GetAllForMovies(movieIDs []int64) (map[int64][]*Credit, error)
+	GetAllForPerson(personID int64, filters Filters) ([]*Credit, Metadata, error)
+	ReplaceForMovie(movieID int64, credits []*Credit) error
+}
+
+// RatingStore is implemented by every backend which can persist the ratings users give movies. Set() and Delete()
+// keep the rating aggregates of the movie up to date.
+type RatingStore interface {
+	Set(rating *Rating) error
+	Delete(userID, movieID int64) error
+	Get(userID, movieID int64) (*Rating, error)
+	GetAllForUser(userID int64, filters Filters) ([]*Rating, Metadata, error)
+}
+
+// ImageStore is implemented by every backend which can persist the images of movies. Set() and Remove() return the
+// image they replaced or removed, so that the caller can delete its blobs.
+type ImageStore interface {
+	Set(movieID int64, kind string, image *Image) (*Image, error)
+	Remove(movieID int64, kind string) (*Image, error)
+}
+
+// WatchlistStore is implemented by every backend which can persist users' watchlists. Add(), Update() and Remove()
+// keep the positions on the watchlist in order.
+type WatchlistStore interface {
+	Add(item *WatchlistItem) error
+	Update(item *WatchlistItem) error
+	Remove(userID, movieID int64) error
+	Get(userID, movieID int64) (*WatchlistItem, error)
+	GetAllForUser(userID int64, watched *bool, filters Filters) ([]*WatchlistItem, Metadata, error)
+}
+
+// GenreStore is implemented by every backend which can persist the genre taxonomy. Insert(), Update() and Merge()
+// keep slugs and aliases unique across genres, and Update() and Merge() rewrite the genres of the affected movies,
+// whose revisions are left to the caller.
+type GenreStore interface {
+	Insert(genre *Genre) error
+	Get(id int64) (*Genre, error)
+	Update(genre *Genre) error
+	Merge(sourceID, targetID int64) (*Genre, error)
+	GetAll(filters Filters) ([]*Genre, Metadata, error)
+	Resolve(names []string) ([]string, error)
+}
+
+// CollectionStore is implemented by every backend which can persist collections of movies. Insert() and Update()
+// replace the movies of the collection with its MovieIDs, in order, and return ErrMissingCollectionMovie if one of
+// them doesn't exist.
+type CollectionStore interface {
+	Insert(collection *Collection) error
+	Get(id int64) (*Collection, error)
+	Update(collection *Collection) error
+	Delete(id int64) error
+	GetAll(name string, filters Filters) ([]*Collection, Metadata, error)
+	GetAllForMovie(movieID int64) ([]*Collection, error)
+}
+
+// IdempotencyStore is implemented by every backend which can persist the requests made with an Idempotency-Key
+// header and their responses. Reserve() claims a key atomically, so that only one of several concurrent requests with
+// the same key runs, and Renew() keeps the claim of a request which runs for a long time.
+type IdempotencyStore interface {
+	Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error)
+	Complete(record *IdempotencyRecord) error
+	Renew(userID int64, key string, expiresAt time.Time) error
+	Release(userID int64, key string) error
+	DeleteExpired() error
+}
+
+// UserStore is implemented by every backend which can persist users.
+type UserStore interface {
+	Insert(user *User) error
+	GetByEmail(email string) (*User, error)
+	Update(user *User) error
+	GetForToken(tokenScope, tokenPlaintext string) (*User, error)
+}
+
+// TokenStore is implemented by every backend which can persist tokens.
+type TokenStore interface {
+	New(userID int64, ttl time.Duration, scope string) (*Token, error)
+	Insert(token *Token) error
+	DeleteAllForUser(scope string, userID int64) error
+}
+
+// PermissionStore is implemented by every backend which can persist user permissions.
+type PermissionStore interface {
+	GetAllForUser(userID int64) (Permissions, error)
+	AddForUser(userID int64, codes ...string) error
+}
+
 type Models struct {
-	Movies     MovieModel
-	Tokens     TokenModel
-	User       UserModel
-	Permission PermissionModel
+	Movies      MovieStore
+	Revisions   RevisionStore
+	People      PersonStore
+	Credits     CreditStore
+	Ratings     RatingStore
+	Images      ImageStore
+	Watchlist   WatchlistStore
+	Genres      GenreStore
+	Collections CollectionStore
+	Idempotency IdempotencyStore
+	Tokens      TokenStore
+	User        UserStore
+	Permission  PermissionStore
+
+	// atomic runs a function inside a transaction. It is nil for models which are already bound to one.
+	atomic func(fn func(tx Models) error) error
 }
 
+// NewModels returns a Models instance backed by the PostgreSQL connection pool.
 func NewModels(db *sql.DB) Models {
+	models := newModels(db)
+
+	models.atomic = func(fn func(tx Models) error) error {
+		tx, err := db.BeginTx(context.Background(), nil)
+		if err != nil {
+			return err
+		}
+
+		// Roll back if fn panics, so that the transaction doesn't hold on to its connection from the pool, and let the
+		// panic carry on up to recoverPanic().
+		defer func() {
+			if p := recover(); p != nil {
+				tx.Rollback()
+				panic(p)
+			}
+		}()
+
+		err = fn(newModels(tx))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		return tx.Commit()
+	}
+
+	return models
+}
+
+func newModels(db DBTX) Models {
 	return Models{
-		Movies:     MovieModel{DB: db},
-		Tokens:     TokenModel{DB: db},
-		User:       UserModel{DB: db},
-		Permission: PermissionModel{DB: db},
+		Movies:      MovieModel{DB: db},
+		Revisions:   RevisionModel{DB: db},
+		People:      PersonModel{DB: db},
+		Credits:     CreditModel{DB: db},
+		Ratings:     RatingModel{DB: db},
+		Images:      ImageModel{DB: db},
+		Watchlist:   WatchlistModel{DB: db},
+		Genres:      GenreModel{DB: db},
+		Collections: CollectionModel{DB: db},
+		Idempotency: IdempotencyModel{DB: db},
+		Tokens:      TokenModel{DB: db},
+		User:        UserModel{DB: db},
+		Permission:  PermissionModel{DB: db},
 	}
 }
 
-// Create a helper function which returns a Models instance containing the rock models only.
+// Atomic calls fn with a set of models bound to a single transaction, which is committed if fn returns nil and rolled
+// back otherwise. Calling Atomic() on models which are already inside a transaction simply joins it.
+func (m Models) Atomic(fn func(tx Models) error) error {
+	if m.atomic == nil {
+		return fn(m)
+	}
 
-/*
-COME BACK TO THIS LINE OF CODE
-*/
-// func NewMockModels() Models {
-// 	return Models{
-// 		Movies: MockMovieModel{},
-// 	}
-// }
+	return m.atomic(fn)
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"github.com/lib/pq"
+)
+
+// MovieFields lists the JSON names of the fields a movie response can be narrowed down to, in the order they appear
+// in the response.
+var MovieFields = []string{
+	"id", "title", "original_title", "original_language", "titles", "year", "duration", "genres", "version", "created_at",
+	"rating_average", "rating_count", "images",
+}
+
+// movieTableColumns lists the columns of the movies table a movie is read from, in the order of MovieFields.
+var movieTableColumns = []string{
+	"id", "title", "original_language", "titles", "year", "duration", "genres", "version", "created_at", "rating_average",
+	"rating_count", "images",
+}
+
+// movieFieldColumns lists the columns the fields of a movie response are read from, where they differ from the
+// field's own name. The title is chosen from the original title and its translations.
+var movieFieldColumns = map[string][]string{
+	"title":          {"title", "original_language", "titles"},
+	"original_title": {"title"},
+}
+
+// movieColumns returns the columns to read for each movie of a list. Besides those of the fields requested in the
+// filters, the sort column is read, as it is stored in the cursors.
+func movieColumns(filters Filters) []string {
+	return movieFieldsColumns(filters.Fields, filters.sortColumn())
+}
+
+// movieFieldsColumns returns the columns to read for the fields of a movie, along with any extra columns. The id and
+// version are always read, as they identify the state of the movie. Every column is read when no fields are given.
+func movieFieldsColumns(fields []string, extra ...string) []string {
+	if len(fields) == 0 {
+		return movieTableColumns
+	}
+
+	needed := map[string]bool{"id": true, "version": true}
+	for _, column := range extra {
+		needed[column] = true
+	}
+	for _, field := range fields {
+		columns, ok := movieFieldColumns[field]
+		if !ok {
+			columns = []string{field}
+		}
+		for _, column := range columns {
+			needed[column] = true
+		}
+	}
+
+	columns := []string{}
+	for _, column := range movieTableColumns {
+		if needed[column] {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// movieScanTargets returns the destinations in movie for the columns returned by movieColumns(), in the same order.
+func movieScanTargets(movie *Movie, columns []string) []interface{} {
+	targets := make([]interface{}, 0, len(columns))
+
+	for _, column := range columns {
+		switch column {
+		case "id":
+			targets = append(targets, &movie.ID)
+		case "title":
+			targets = append(targets, &movie.Title)
+		case "original_language":
+			targets = append(targets, &movie.OriginalLanguage)
+		case "titles":
+			targets = append(targets, &movie.Titles)
+		case "year":
+			targets = append(targets, &movie.Year)
+		case "duration":
+			targets = append(targets, &movie.Duration)
+		case "genres":
+			targets = append(targets, pq.Array(&movie.Genres))
+		case "version":
+			targets = append(targets, &movie.Version)
+		case "created_at":
+			targets = append(targets, &movie.CreatedAt)
+		case "rating_average":
+			targets = append(targets, &movie.RatingAverage)
+		case "rating_count":
+			targets = append(targets, &movie.RatingCount)
+		case "images":
+			targets = append(targets, &movie.Images)
+		default:
+			panic("unsupported movie column: " + column)
+		}
+	}
+
+	return targets
+}
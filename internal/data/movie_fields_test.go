@@ -0,0 +1,30 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMovieFieldsColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		extra  []string
+		want   []string
+	}{
+		{"No fields", nil, nil, movieTableColumns},
+		{"Fields", []string{"year", "duration"}, nil, []string{"id", "year", "duration", "version"}},
+		{"Title", []string{"title"}, nil, []string{"id", "title", "original_language", "titles", "version"}},
+		{"Original title", []string{"original_title"}, nil, []string{"id", "title", "version"}},
+		{"Sort column", []string{"title"}, []string{"rating_average"}, []string{"id", "title", "original_language", "titles", "version", "rating_average"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := movieFieldsColumns(tt.fields, tt.extra...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got columns %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
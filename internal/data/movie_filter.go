@@ -0,0 +1,161 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+// MovieFilter selects the movies listed by GetAll(), ForEach() and Facets(). The zero value of each field leaves that
+// condition out, so the zero MovieFilter matches every movie which isn't in the trash.
+type MovieFilter struct {
+	// Title is a full-text search of the original title and its translations. Fuzzy makes it tolerate typos, by
+	// trigram similarity, and match the beginnings of words.
+	Title string
+	Fuzzy bool
+	// Genres must all be held by a movie, while it only needs to hold one of GenresAny.
+	Genres    []string
+	GenresAny []string
+	// Director and Actor are the ids of a person credited in that role.
+	Director int64
+	Actor    int64
+	// Collection is the id of a collection the movie belongs to.
+	Collection int64
+	// YearMin, YearMax, DurationMin and DurationMax are inclusive bounds.
+	YearMin     int32
+	YearMax     int32
+	DurationMin int32
+	DurationMax int32
+	// CreatedAfter is inclusive and CreatedBefore exclusive, so that consecutive ranges don't overlap.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func ValidateMovieFilter(v *validator.Validator, f MovieFilter) {
+	v.Check(f.Director >= 0, "director", "must be a positive integer")
+	v.Check(f.Actor >= 0, "actor", "must be a positive integer")
+	v.Check(f.Collection >= 0, "collection_id", "must be a positive integer")
+
+	v.Check(f.YearMin >= 0, "year_min", "must be a positive integer")
+	v.Check(f.YearMax >= 0, "year_max", "must be a positive integer")
+	if f.YearMin > 0 && f.YearMax > 0 {
+		v.Check(f.YearMin <= f.YearMax, "year_max", "must not be less than year_min")
+	}
+
+	v.Check(f.DurationMin >= 0, "duration_min", "must be a positive integer")
+	v.Check(f.DurationMax >= 0, "duration_max", "must be a positive integer")
+	if f.DurationMin > 0 && f.DurationMax > 0 {
+		v.Check(f.DurationMin <= f.DurationMax, "duration_max", "must not be less than duration_min")
+	}
+
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() {
+		v.Check(f.CreatedAfter.Before(f.CreatedBefore), "created_before", "must be later than created_after")
+	}
+}
+
+// movieConditions selects the movies which are not in the trash and match a MovieFilter, whose fields are bound to
+// the placeholders in the order given by MovieFilter.args(). The title condition is left out, to be filled in by
+// MovieFilter.conditions(). The title and genres conditions are served by the tsvector, trigram and GIN indexes on the
+// movies table, and the ranges by the year, duration and created_at indexes.
+const movieConditions = `deleted_at IS NULL
+		AND %s
+		AND (genres @> $2 OR $2 = '{}')
+		AND (genres && $3 OR $3 = '{}')
+		AND ($4 = 0 OR EXISTS (
+			SELECT 1 FROM credits WHERE credits.movie_id = movies.id AND credits.person_id = $4 AND credits.role = 'director'))
+		AND ($5 = 0 OR EXISTS (
+			SELECT 1 FROM credits WHERE credits.movie_id = movies.id AND credits.person_id = $5 AND credits.role = 'actor'))
+		AND ($6 = 0 OR year >= $6)
+		AND ($7 = 0 OR year <= $7)
+		AND ($8 = 0 OR duration >= $8)
+		AND ($9 = 0 OR duration <= $9)
+		AND ($10::timestamptz IS NULL OR created_at >= $10)
+		AND ($11::timestamptz IS NULL OR created_at < $11)
+		AND ($12 = 0 OR EXISTS (
+			SELECT 1 FROM collection_movies
+			WHERE collection_movies.movie_id = movies.id AND collection_movies.collection_id = $12))`
+
+// conditions returns the WHERE clause selecting the movies which match the filter. The title search runs against
+// the original title and its translations, joined by movie_search_titles(). A fuzzy title matches when the search is
+// similar enough to a run of words of the titles (the <% operator of pg_trgm), or when every word of the search
+// begins a word of the titles, which is bound to $13 as a prefix tsquery.
+func (f MovieFilter) conditions() string {
+	title := `(to_tsvector('simple', movie_search_titles(title, titles)) @@ plainto_tsquery('simple', $1) OR $1 = '')`
+	if f.Fuzzy {
+		title = `($1 = '' OR $1 <% movie_search_titles(title, titles)
+			OR to_tsvector('simple', movie_search_titles(title, titles)) @@ to_tsquery('simple', $13))`
+	}
+
+	return fmt.Sprintf(movieConditions, title)
+}
+
+// movieSource returns the FROM item for the movie list queries: the movies table along with the relevance column,
+// which holds the filter's relevance() negated so that sorting on it in ascending order lists the best matches first.
+// PostgreSQL flattens the subquery, so the indexes on movies are still used.
+func (f MovieFilter) movieSource() string {
+	return fmt.Sprintf("(SELECT *, -(%s) AS relevance FROM movies) AS movies", f.relevance())
+}
+
+// relevance returns an expression scoring how well a movie's titles match the filter: their ts_rank() for a full-text
+// search, or their trigram similarity for a fuzzy one.
+func (f MovieFilter) relevance() string {
+	if f.Fuzzy {
+		return `greatest(similarity(title, $1), word_similarity($1, movie_search_titles(title, titles)))`
+	}
+	return `ts_rank(to_tsvector('simple', movie_search_titles(title, titles)), plainto_tsquery('simple', $1))`
+}
+
+// args returns the values bound to the placeholders of conditions() and relevance(). A query using them numbers its
+// own placeholders from len(args())+1.
+func (f MovieFilter) args() []interface{} {
+	args := []interface{}{
+		f.Title,
+		pq.Array(nonNilStrings(f.Genres)),
+		pq.Array(nonNilStrings(f.GenresAny)),
+		f.Director,
+		f.Actor,
+		f.YearMin,
+		f.YearMax,
+		f.DurationMin,
+		f.DurationMax,
+		nullTime(f.CreatedAfter),
+		nullTime(f.CreatedBefore),
+		f.Collection,
+	}
+
+	if f.Fuzzy {
+		args = append(args, prefixQuery(f.Title))
+	}
+
+	return args
+}
+
+// prefixQuery turns a search into a tsquery matching titles with a word beginning with each of its words, e.g.
+// "the godf" becomes "the:* & godf:*". Only letters and digits are kept, so the result is always valid tsquery
+// syntax.
+func prefixQuery(search string) string {
+	words := lexemes(search)
+	for i := range words {
+		words[i] += ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// nonNilStrings returns an empty slice in place of nil, which pq.Array() would send as NULL rather than '{}'.
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// nullTime returns nil for the zero time, so that it is sent as NULL.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -3,26 +3,102 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 	"github.com/lorezi/duxfilm/internal/validator"
+	"golang.org/x/text/language"
 )
 
 type MovieModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year"`
-	Duration  int32     `json:"duration"`
-	Genres    []string  `json:"genres"`
-	Version   int32     `json:"version"`
-	CreatedAt time.Time `json:"created_at"`
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	// OriginalLanguage is the BCP 47 tag of the language of Title, if known, and Titles holds translations of it by
+	// tag. Encoded as JSON, title is the best match for the chosen languages and original_title is Title.
+	OriginalLanguage string      `json:"original_language"`
+	Titles           MovieTitles `json:"titles"`
+	Year             int32       `json:"year"`
+	Duration         int32       `json:"duration"`
+	Genres           []string    `json:"genres"`
+	Version          int32       `json:"version"`
+	CreatedAt        time.Time   `json:"created_at"`
+	// RatingAverage and RatingCount summarise the ratings users have given the movie. They are maintained by the
+	// RatingStore and are never written by Update().
+	RatingAverage float64 `json:"rating_average"`
+	RatingCount   int32   `json:"rating_count"`
+	// Images holds the artwork of the movie by kind. It is maintained by the ImageStore and is never written by
+	// Update().
+	Images MovieImages `json:"images"`
+	// DeletedAt is set once the movie has been moved to the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// relevance is the negated score of how well the title matched the filter of a list, read back so that it can be
+	// stored in a cursor.
+	relevance float64
+	// durationFormat is the format Duration is written in.
+	durationFormat DurationFormat
+	// languages are the languages the title is chosen from, most preferred first.
+	languages []language.Tag
+}
+
+// SetDurationFormat chooses the format the duration of the movie is written in when it is encoded as JSON.
+func (m *Movie) SetDurationFormat(format DurationFormat) {
+	m.durationFormat = format
+}
+
+// MarshalJSON writes the movie with its title in the chosen languages and its duration in the chosen format. The
+// fields are listed in the same order and with the same names as in Movie, except that the stored title is written
+// as original_title, after the localized one.
+func (m Movie) MarshalJSON() ([]byte, error) {
+	// A movie without images or translations has an empty object of them rather than null.
+	images := m.Images
+	if images == nil {
+		images = MovieImages{}
+	}
+	titles := m.Titles
+	if titles == nil {
+		titles = MovieTitles{}
+	}
+
+	return json.Marshal(struct {
+		ID               int64       `json:"id"`
+		Title            string      `json:"title"`
+		OriginalTitle    string      `json:"original_title"`
+		OriginalLanguage string      `json:"original_language"`
+		Titles           MovieTitles `json:"titles"`
+		Year             int32       `json:"year"`
+		Duration         interface{} `json:"duration"`
+		Genres           []string    `json:"genres"`
+		Version          int32       `json:"version"`
+		CreatedAt        time.Time   `json:"created_at"`
+		RatingAverage    float64     `json:"rating_average"`
+		RatingCount      int32       `json:"rating_count"`
+		Images           MovieImages `json:"images"`
+		DeletedAt        *time.Time  `json:"deleted_at,omitempty"`
+	}{
+		ID:               m.ID,
+		Title:            m.LocalizedTitle(),
+		OriginalTitle:    m.Title,
+		OriginalLanguage: m.OriginalLanguage,
+		Titles:           titles,
+		Year:             m.Year,
+		Duration:         m.durationFormat.format(m.Duration),
+		Genres:           m.Genres,
+		Version:          m.Version,
+		CreatedAt:        m.CreatedAt,
+		RatingAverage:    m.RatingAverage,
+		RatingCount:      m.RatingCount,
+		Images:           images,
+		DeletedAt:        m.DeletedAt,
+	})
 }
 
 type MovieResponse struct {
@@ -35,17 +111,21 @@ type MovieResponse struct {
 }
 
 type MovieRequest struct {
-	ID       int64    `json:"id"`
-	Title    string   `json:"title"`
-	Year     int32    `json:"year"`
-	Duration Duration `json:"duration"`
-	Genres   []string `json:"genres"`
+	ID               int64       `json:"id"`
+	Title            string      `json:"title"`
+	OriginalLanguage string      `json:"original_language,omitempty"`
+	Titles           MovieTitles `json:"titles,omitempty"`
+	Year             int32       `json:"year"`
+	Duration         Duration    `json:"duration"`
+	Genres           []string    `json:"genres"`
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 
+	validateTitles(v, movie)
+
 	v.Check(movie.Year != 0, "year", "must be provided")
 	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
 	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
@@ -61,11 +141,11 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 
 func (m MovieModel) Insert(movie *Movie) error {
 	query := `
-		INSERT INTO movies (title, year, duration, genres)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO movies (title, original_language, titles, year, duration, genres)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at, version
 	`
-	args := []interface{}{movie.Title, movie.Year, movie.Duration, pq.Array(movie.Genres)}
+	args := []interface{}{movie.Title, movie.OriginalLanguage, movie.Titles, movie.Year, movie.Duration, pq.Array(movie.Genres)}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -74,15 +154,32 @@ func (m MovieModel) Insert(movie *Movie) error {
 }
 
 func (m MovieModel) Get(id int64) (*Movie, error) {
+	return m.get(id, nil, false)
+}
+
+// GetFields is like Get, but only reads the columns the fields of the movie, as named in MovieFields, are read from.
+// The other fields are left at their zero values. Every field is read when none are given.
+func (m MovieModel) GetFields(id int64, fields []string) (*Movie, error) {
+	return m.get(id, fields, false)
+}
+
+// GetIncludingDeleted is like Get, but also finds the movie when it is in the trash.
+func (m MovieModel) GetIncludingDeleted(id int64) (*Movie, error) {
+	return m.get(id, nil, true)
+}
+
+func (m MovieModel) get(id int64, fields []string, includeDeleted bool) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-		SELECT  id, title, year, duration, genres, version, created_at
+	columns := movieFieldsColumns(fields)
+
+	query := fmt.Sprintf(`
+		SELECT %s
 		FROM movies
-		WHERE id = $1
-	`
+		WHERE id = $1 AND (deleted_at IS NULL OR $2)
+	`, strings.Join(columns, ", "))
 
 	var movie Movie
 
@@ -90,15 +187,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.Title,
-		&movie.Year,
-		&movie.Duration,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-		&movie.CreatedAt,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id, includeDeleted).Scan(movieScanTargets(&movie, columns)...)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -110,15 +199,111 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
+// Missing returns, in the order given, those of the ids which don't belong to a movie outside the trash. The movies
+// which do are locked until the end of the transaction, so that they can't be moved to the trash or purged before it
+// commits. It should be called inside Models.Atomic().
+func (m MovieModel) Missing(ids []int64) ([]int64, error) {
+	query := `
+		SELECT id FROM movies
+		WHERE id = ANY($1) AND deleted_at IS NULL
+		FOR SHARE`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(nonNilInt64s(ids)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[int64]bool, len(ids))
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		found[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	missing := []int64{}
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, id)
+		}
+	}
+
+	return missing, nil
+}
+
+// GetAllForGenre lists every movie with the genre, including those in the trash, in order of id. Renaming or merging
+// the genre rewrites all of them.
+func (m MovieModel) GetAllForGenre(slug string) ([]*Movie, error) {
+	query := `
+		SELECT id, title, original_language, titles, year, duration, genres, version, rating_average, rating_count, images, created_at
+		FROM movies
+		WHERE genres @> ARRAY[$1]
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.OriginalLanguage,
+			&movie.Titles,
+			&movie.Year,
+			&movie.Duration,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.RatingAverage,
+			&movie.RatingCount,
+			&movie.Images,
+			&movie.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
 func (m MovieModel) Update(movie *Movie) error {
 	query := `
 		UPDATE movies
-		SET title = $1, year = $2, duration = $3, genres= $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET title = $1, original_language = $2, titles = $3, year = $4, duration = $5, genres= $6, version = version + 1
+		WHERE id = $7 AND version = $8 AND deleted_at IS NULL
 		RETURNING version`
 
 	args := []interface{}{
 		movie.Title,
+		movie.OriginalLanguage,
+		movie.Titles,
 		movie.Year,
 		movie.Duration,
 		pq.Array(movie.Genres),
@@ -129,7 +314,7 @@ func (m MovieModel) Update(movie *Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID)
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ErrEditConflict
@@ -140,48 +325,44 @@ func (m MovieModel) Update(movie *Movie) error {
 	return nil
 }
 
-func (m MovieModel) Delete(id int64) error {
-	if id < 1 {
-		return ErrRecordNotFound
-	}
-
-	query := `DELETE FROM movies WHERE id = $1`
+// Delete moves a movie to the trash. It stays in the database, hidden from Get() and GetAll(), until it is either
+// restored or purged. Like Update(), it fails with ErrEditConflict if the movie's version has moved on.
+func (m MovieModel) Delete(movie *Movie) error {
+	query := `
+		UPDATE movies
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING version, deleted_at`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
-	if err != nil {
-		return err
-	}
-	rowsAffected, err := result.RowsAffected()
+	err := m.DB.QueryRowContext(ctx, query, movie.ID, movie.Version).Scan(&movie.Version, &movie.DeletedAt)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEditConflict
+		}
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
-	}
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// GetAllDeleted lists the movies in the trash.
+func (m MovieModel) GetAllDeleted(filters Filters) ([]*Movie, Metadata, error) {
 	query := fmt.Sprintf(
 		`
-		SELECT count(*) OVER(), id, created_at, title, year, duration, genres, version
+		SELECT count(*) OVER(), id, created_at, title, original_language, titles, year, duration, genres, version, rating_average, rating_count, images, deleted_at
 		FROM movies
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (genres @> $2 OR $2 = '{}')
+		WHERE deleted_at IS NOT NULL
 		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4
+		LIMIT $1 OFFSET $2
 	`, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
-
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -200,10 +381,16 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.ID,
 			&movie.CreatedAt,
 			&movie.Title,
+			&movie.OriginalLanguage,
+			&movie.Titles,
 			&movie.Year,
 			&movie.Duration,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.RatingAverage,
+			&movie.RatingCount,
+			&movie.Images,
+			&movie.DeletedAt,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -215,7 +402,296 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 		return nil, Metadata{}, err
 	}
 
+	return movies, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Restore takes a movie back out of the trash and returns it.
+func (m MovieModel) Restore(id int64) (*Movie, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		RETURNING id, title, original_language, titles, year, duration, genres, version, rating_average, rating_count, images, created_at`
+
+	var movie Movie
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&movie.ID,
+		&movie.Title,
+		&movie.OriginalLanguage,
+		&movie.Titles,
+		&movie.Year,
+		&movie.Duration,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.RatingAverage,
+		&movie.RatingCount,
+		&movie.Images,
+		&movie.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &movie, nil
+}
+
+// Purge permanently deletes the movies which were moved to the trash before the given time, and returns their ids,
+// titles and images so that the caller can clean up anything stored outside the database.
+func (m MovieModel) Purge(deletedBefore time.Time) ([]*Movie, error) {
+	query := `
+		DELETE FROM movies
+		WHERE deleted_at IS NOT NULL AND deleted_at < $1
+		RETURNING id, title, images`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(&movie.ID, &movie.Title, &movie.Images)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+// GetAll lists the movies matching the filter.
+func (m MovieModel) GetAll(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error) {
+	// A cursor switches to keyset pagination, which avoids scanning and counting every preceding row.
+	if c, ok := filters.cursor(); ok {
+		return m.getAllFromCursor(filter, filters, c)
+	}
+
+	args := filter.args()
+	columns := movieColumns(filters)
+
+	query := fmt.Sprintf(
+		`
+		SELECT count(*) OVER(), %s, relevance
+		FROM %s
+		WHERE %s
+		ORDER BY %s %s, id ASC
+		LIMIT $%d OFFSET $%d
+	`, strings.Join(columns, ", "), filter.movieSource(), filter.conditions(), filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args = append(args, filters.limit(), filters.offset())
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		dest := append([]interface{}{&totalRecords}, movieScanTargets(&movie, columns)...)
+
+		err := rows.Scan(append(dest, &movie.relevance)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	movieCursors(&metadata, filters, movies, filters.Page > 1, filters.offset()+len(movies) < totalRecords)
 
 	return movies, metadata, nil
 }
+
+func (m MovieModel) getAllFromCursor(filter MovieFilter, filters Filters, c cursor) ([]*Movie, Metadata, error) {
+	args := filter.args()
+	n := len(args)
+	columns := movieColumns(filters)
+
+	// Fetch one extra row to find out whether there is another page beyond this one.
+	query := fmt.Sprintf(
+		`
+		SELECT %s, relevance
+		FROM %s
+		WHERE %s
+		AND %s
+		ORDER BY %s
+		LIMIT $%d
+	`, strings.Join(columns, ", "), filter.movieSource(), filter.conditions(), filters.keysetCondition(c, fmt.Sprintf("$%d", n+1), fmt.Sprintf("$%d", n+2)), filters.keysetOrder(c), n+3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args = append(args, c.Key, c.ID, filters.limit()+1)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(append(movieScanTargets(&movie, columns), &movie.relevance)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	movies, metadata := keysetPage(movies, filters, c)
+
+	return movies, metadata, nil
+}
+
+// ForEachTimeout is how long ForEach() may take to stream its rows. Streaming a whole catalogue takes far longer than
+// a single page, so it allows more time than usual.
+const ForEachTimeout = 5 * time.Minute
+
+// ForEach calls fn for every movie matching the same parameters as GetAll(), in the order given by the filters' sort.
+// Paging is ignored and rows are streamed from the database one at a time, so the full result set is never held in
+// memory. Iteration stops at the first error returned by fn, or once ForEachTimeout has passed.
+func (m MovieModel) ForEach(filter MovieFilter, filters Filters, fn func(movie *Movie) error) error {
+	columns := movieColumns(filters)
+
+	query := fmt.Sprintf(
+		`
+		SELECT %s, relevance
+		FROM %s
+		WHERE %s
+		ORDER BY %s %s, id ASC
+	`, strings.Join(columns, ", "), filter.movieSource(), filter.conditions(), filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), ForEachTimeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filter.args()...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(append(movieScanTargets(&movie, columns), &movie.relevance)...)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&movie)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// keysetPage trims the extra row fetched past the end of a keyset page, puts backward pages back into display order
+// and calculates the page metadata.
+func keysetPage(movies []*Movie, filters Filters, c cursor) ([]*Movie, Metadata) {
+	hasMore := len(movies) > filters.limit()
+	if hasMore {
+		movies = movies[:filters.limit()]
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+
+	if c.Backward {
+		for i, j := 0, len(movies)-1; i < j; i, j = i+1, j-1 {
+			movies[i], movies[j] = movies[j], movies[i]
+		}
+		movieCursors(&metadata, filters, movies, hasMore, true)
+	} else {
+		movieCursors(&metadata, filters, movies, true, hasMore)
+	}
+
+	return movies, metadata
+}
+
+// movieSortKey returns the value of a sort column for a movie in the form stored in a cursor.
+func movieSortKey(movie *Movie, column string) string {
+	switch column {
+	case "id":
+		return strconv.FormatInt(movie.ID, 10)
+	case "title":
+		return movie.Title
+	case "year":
+		return strconv.FormatInt(int64(movie.Year), 10)
+	case "duration":
+		return strconv.FormatInt(int64(movie.Duration), 10)
+	case "rating_average":
+		return strconv.FormatFloat(movie.RatingAverage, 'g', -1, 64)
+	case "rating_count":
+		return strconv.FormatInt(int64(movie.RatingCount), 10)
+	case "relevance":
+		return strconv.FormatFloat(movie.relevance, 'g', -1, 64)
+	}
+
+	panic("unsupported sort column: " + column)
+}
+
+// movieCursors sets the cursors pointing at the pages either side of movies. hasPrev and hasNext report whether
+// there are rows before and after the page.
+func movieCursors(metadata *Metadata, filters Filters, movies []*Movie, hasPrev, hasNext bool) {
+	if len(movies) == 0 {
+		return
+	}
+
+	column := filters.sortColumn()
+	first, last := movies[0], movies[len(movies)-1]
+
+	if hasNext {
+		metadata.NextCursor = cursor{Sort: filters.Sort, Key: movieSortKey(last, column), ID: last.ID}.encode()
+	}
+	if hasPrev {
+		metadata.PrevCursor = cursor{Sort: filters.Sort, Key: movieSortKey(first, column), ID: first.ID, Backward: true}.encode()
+	}
+}
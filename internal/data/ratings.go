@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lorezi/duxfilm/internal/validator"
+)
+
+type RatingModel struct {
+	DB DBTX
+}
+
+// Rating is the score a user has given a movie. Each user has at most one rating per movie. MovieTitle is filled in
+// when listing a user's ratings.
+type Rating struct {
+	MovieID    int64     `json:"movie_id"`
+	UserID     int64     `json:"-"`
+	Score      int32     `json:"score"`
+	MovieTitle string    `json:"movie_title,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Score != 0, "score", "must be provided")
+	v.Check(rating.Score >= 1 && rating.Score <= 10, "score", "must be between 1 and 10")
+}
+
+// lockMovie locks the row of a movie which is not in the trash until the end of the transaction, so that ratings of
+// the same movie are applied one at a time and each recalculation of the aggregates sees every committed rating.
+func (m RatingModel) lockMovie(ctx context.Context, movieID int64) error {
+	var id int64
+
+	err := m.DB.QueryRowContext(ctx, `SELECT id FROM movies WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, movieID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// updateAggregates recalculates the rating_average and rating_count columns of a movie.
+func (m RatingModel) updateAggregates(ctx context.Context, movieID int64) error {
+	query := `
+		UPDATE movies
+		SET (rating_average, rating_count) = (
+			SELECT coalesce(avg(score), 0), count(*) FROM ratings WHERE movie_id = $1
+		)
+		WHERE id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, movieID)
+	return err
+}
+
+// Set creates or replaces the user's rating of a movie and updates the movie's aggregates. It returns
+// ErrRecordNotFound if the movie doesn't exist or is in the trash. It must be called inside Models.Atomic() so that
+// the movie stays locked until the aggregates have been updated.
+func (m RatingModel) Set(rating *Rating) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.lockMovie(ctx, rating.MovieID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO ratings (user_id, movie_id, score)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, movie_id) DO UPDATE
+		SET score = EXCLUDED.score, updated_at = NOW()
+		RETURNING created_at, updated_at`
+
+	err = m.DB.QueryRowContext(ctx, query, rating.UserID, rating.MovieID, rating.Score).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return m.updateAggregates(ctx, rating.MovieID)
+}
+
+// Delete removes the user's rating of a movie and updates the movie's aggregates. Like Set(), it must be called
+// inside Models.Atomic().
+func (m RatingModel) Delete(userID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.lockMovie(ctx, movieID)
+	if err != nil {
+		return err
+	}
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM ratings WHERE user_id = $1 AND movie_id = $2`, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return m.updateAggregates(ctx, movieID)
+}
+
+// Get returns the user's rating of a movie.
+func (m RatingModel) Get(userID, movieID int64) (*Rating, error) {
+	query := `
+		SELECT movie_id, user_id, score, created_at, updated_at
+		FROM ratings
+		WHERE user_id = $1 AND movie_id = $2`
+
+	var rating Rating
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(
+		&rating.MovieID,
+		&rating.UserID,
+		&rating.Score,
+		&rating.CreatedAt,
+		&rating.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &rating, nil
+}
+
+// GetAllForUser lists the user's ratings of movies which are not in the trash.
+func (m RatingModel) GetAllForUser(userID int64, filters Filters) ([]*Rating, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), ratings.movie_id, ratings.user_id, ratings.score, movies.title,
+		ratings.created_at, ratings.updated_at
+		FROM ratings
+		INNER JOIN movies ON movies.id = ratings.movie_id
+		WHERE ratings.user_id = $1 AND movies.deleted_at IS NULL
+		ORDER BY ratings.%s %s, ratings.movie_id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	ratings := []*Rating{}
+
+	for rows.Next() {
+		var rating Rating
+
+		err := rows.Scan(
+			&totalRecords,
+			&rating.MovieID,
+			&rating.UserID,
+			&rating.Score,
+			&rating.MovieTitle,
+			&rating.CreatedAt,
+			&rating.UpdatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		ratings = append(ratings, &rating)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return ratings, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
@@ -0,0 +1,272 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Define constants for the action which produced a revision.
+const (
+	RevisionInsert  = "insert"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+	RevisionMerge   = "merge"
+	// RevisionGenre marks the rewrite of a movie's genres by the rename or merge of a genre.
+	RevisionGenre = "genre"
+)
+
+// MovieSnapshot holds the editable fields of a movie as they were at one version.
+type MovieSnapshot struct {
+	Title            string      `json:"title"`
+	OriginalLanguage string      `json:"original_language,omitempty"`
+	Titles           MovieTitles `json:"titles,omitempty"`
+	Year             int32       `json:"year"`
+	Duration         int32       `json:"duration"`
+	Genres           []string    `json:"genres"`
+}
+
+func SnapshotMovie(movie *Movie) *MovieSnapshot {
+	return &MovieSnapshot{
+		Title:            movie.Title,
+		OriginalLanguage: movie.OriginalLanguage,
+		Titles:           copyTitles(movie.Titles),
+		Year:             movie.Year,
+		Duration:         movie.Duration,
+		Genres:           append([]string(nil), movie.Genres...),
+	}
+}
+
+// Apply copies the snapshot's fields onto a movie, leaving its id and version alone.
+func (s *MovieSnapshot) Apply(movie *Movie) {
+	movie.Title = s.Title
+	movie.OriginalLanguage = s.OriginalLanguage
+	movie.Titles = copyTitles(s.Titles)
+	movie.Year = s.Year
+	movie.Duration = s.Duration
+	movie.Genres = append([]string(nil), s.Genres...)
+}
+
+// Revision records a single change to a movie: the full state it had before the change (nil for an insert), the
+// state the change produced, the version the change created and the user who made it. MergedFrom is set on the
+// revisions a movie took over from a movie merged into it, and holds the id of that movie; their versions are those of
+// the merged movie.
+type Revision struct {
+	ID         int64
+	MovieID    int64
+	Version    int32
+	Action     string
+	UserID     int64
+	CreatedAt  time.Time
+	Prior      *MovieSnapshot
+	State      MovieSnapshot
+	MergedFrom int64
+}
+
+// NewRevision describes a change which took a movie from prior (nil for an insert) to its current state.
+func NewRevision(action string, userID int64, prior, movie *Movie) *Revision {
+	rev := &Revision{
+		MovieID: movie.ID,
+		Version: movie.Version,
+		Action:  action,
+		UserID:  userID,
+		State:   *SnapshotMovie(movie),
+	}
+
+	if prior != nil {
+		rev.Prior = SnapshotMovie(prior)
+	}
+
+	return rev
+}
+
+// FieldChange holds the value of a field before and after a revision.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Changes lists the fields whose values differ between the prior state and the new state of the revision. Every
+// field is listed for an insert.
+func (r *Revision) Changes() map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+
+	var prior MovieSnapshot
+	if r.Prior != nil {
+		prior = *r.Prior
+	}
+
+	change := func(field string, from, to interface{}, equal bool) {
+		if r.Prior == nil {
+			from = nil
+		} else if equal {
+			return
+		}
+		changes[field] = FieldChange{From: from, To: to}
+	}
+
+	change("title", prior.Title, r.State.Title, prior.Title == r.State.Title)
+	change("original_language", prior.OriginalLanguage, r.State.OriginalLanguage, prior.OriginalLanguage == r.State.OriginalLanguage)
+	change("titles", prior.Titles, r.State.Titles, equalTitles(prior.Titles, r.State.Titles))
+	change("year", prior.Year, r.State.Year, prior.Year == r.State.Year)
+	change("duration", prior.Duration, r.State.Duration, prior.Duration == r.State.Duration)
+	change("genres", prior.Genres, r.State.Genres, equalStrings(prior.Genres, r.State.Genres))
+
+	return changes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type RevisionModel struct {
+	DB DBTX
+}
+
+func (m RevisionModel) Insert(rev *Revision) error {
+	var prior interface{}
+	if rev.Prior != nil {
+		js, err := json.Marshal(rev.Prior)
+		if err != nil {
+			return err
+		}
+		prior = string(js)
+	}
+
+	state, err := json.Marshal(rev.State)
+	if err != nil {
+		return err
+	}
+
+	// Revisions made without an authenticated user are stored with a NULL user_id.
+	userID := sql.NullInt64{Int64: rev.UserID, Valid: rev.UserID != 0}
+
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, action, user_id, prior, state)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	args := []interface{}{rev.MovieID, rev.Version, rev.Action, userID, prior, string(state)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&rev.ID, &rev.CreatedAt)
+}
+
+// GetAllForMovie lists the revisions of a movie, sorted by version.
+func (m RevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*Revision, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, movie_id, version, action, user_id, created_at, prior, state, merged_from
+		FROM movie_revisions
+		WHERE movie_id = $1
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		rev, err := scanRevision(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return revisions, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Get returns the revision which created the given version of a movie. Revisions taken over from merged movies are
+// left out, as their versions belong to those movies.
+func (m RevisionModel) Get(movieID int64, version int32) (*Revision, error) {
+	query := `
+		SELECT id, movie_id, version, action, user_id, created_at, prior, state, merged_from
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2 AND merged_from IS NULL
+		ORDER BY id DESC
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rev, err := scanRevision(m.DB.QueryRowContext(ctx, query, movieID, version))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// scanRevision scans a row selected by the revision queries. Any extra columns selected before the revision's own
+// columns (such as a window count) are scanned into leading.
+func scanRevision(row interface{ Scan(...interface{}) error }, leading ...interface{}) (*Revision, error) {
+	var rev Revision
+	var userID, mergedFrom sql.NullInt64
+	var prior, state []byte
+
+	dest := append(leading,
+		&rev.ID,
+		&rev.MovieID,
+		&rev.Version,
+		&rev.Action,
+		&userID,
+		&rev.CreatedAt,
+		&prior,
+		&state,
+		&mergedFrom,
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	rev.UserID = userID.Int64
+	rev.MergedFrom = mergedFrom.Int64
+
+	if prior != nil {
+		rev.Prior = &MovieSnapshot{}
+		err = json.Unmarshal(prior, rev.Prior)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = json.Unmarshal(state, &rev.State)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
@@ -0,0 +1,403 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStores runs a test against every backend, so that the in-memory models keep honouring the semantics of the
+// PostgreSQL ones: against the in-memory models always, and against PostgreSQL when TEST_DB_DSN names a migrated
+// database. That database is emptied before each test, so it must not hold anything worth keeping.
+func testStores(t *testing.T, test func(t *testing.T, models Models)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryModels())
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DB_DSN")
+		if dsn == "" {
+			t.Skip("TEST_DB_DSN is not set")
+		}
+
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		// The tables referencing these are emptied along with them. The genres and permissions seeded by the
+		// migrations are kept.
+		_, err = db.Exec(`TRUNCATE users, movies, people, collections RESTART IDENTITY CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, NewModels(db))
+	})
+}
+
+// testFilters reads the first page of a list in order of id.
+var testFilters = Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}}
+
+// insertTestMovie stores a movie with the title, year and genres, and returns it.
+func insertTestMovie(t *testing.T, models Models, title string, year int32, genres ...string) *Movie {
+	t.Helper()
+
+	movie := &Movie{Title: title, Year: year, Duration: 100, Genres: genres}
+
+	err := models.Movies.Insert(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return movie
+}
+
+// insertTestUser stores an activated user with the email, and returns it.
+func insertTestUser(t *testing.T, models Models, email string) *User {
+	t.Helper()
+
+	user := &User{Name: "Test User", Email: email, Activated: true}
+
+	err := user.Password.Set("pa55word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.User.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+// movieIDs returns the ids of the movies, in order.
+func movieIDs(movies []*Movie) []int64 {
+	ids := []int64{}
+	for _, movie := range movies {
+		ids = append(ids, movie.ID)
+	}
+	return ids
+}
+
+func TestMovieUpdateConflict(t *testing.T) {
+	testStores(t, func(t *testing.T, models Models) {
+		movie := insertTestMovie(t, models, "Moana", 2016, "animation")
+
+		first, err := models.Movies.Get(movie.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := models.Movies.Get(movie.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		first.Title = "Vaiana"
+		err = models.Movies.Update(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if first.Version != 2 {
+			t.Errorf("got version %d after the update; want 2", first.Version)
+		}
+
+		// The second copy was read before the first update, so saving it would undo that update.
+		second.Title = "Oceania"
+		err = models.Movies.Update(second)
+		if !errors.Is(err, ErrEditConflict) {
+			t.Fatalf("got error %v for the stale update; want %v", err, ErrEditConflict)
+		}
+
+		stored, err := models.Movies.Get(movie.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.Title != "Vaiana" || stored.Version != 2 {
+			t.Errorf("got title %q at version %d; want %q at version 2", stored.Title, stored.Version, "Vaiana")
+		}
+	})
+}
+
+func TestMovieTrash(t *testing.T) {
+	testStores(t, func(t *testing.T, models Models) {
+		live := insertTestMovie(t, models, "Moana", 2016, "animation")
+		trashed := insertTestMovie(t, models, "Up", 2009, "animation")
+
+		err := models.Movies.Delete(trashed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = models.Movies.Get(trashed.ID)
+		if !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("got error %v reading a movie in the trash; want %v", err, ErrRecordNotFound)
+		}
+
+		found, err := models.Movies.GetIncludingDeleted(trashed.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found.Title != "Up" {
+			t.Errorf("got title %q; want %q", found.Title, "Up")
+		}
+
+		missing, err := models.Movies.Missing([]int64{trashed.ID, 99, live.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := []int64{trashed.ID, 99}; !reflect.DeepEqual(missing, want) {
+			t.Errorf("got missing ids %v; want %v", missing, want)
+		}
+	})
+}
+
+func TestUserDuplicateEmail(t *testing.T) {
+	testStores(t, func(t *testing.T, models Models) {
+		insertTestUser(t, models, "alice@example.com")
+
+		user := &User{Name: "Other User", Email: "alice@example.com"}
+
+		err := user.Password.Set("pa55word")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = models.User.Insert(user)
+		if !errors.Is(err, ErrDuplicateEmail) {
+			t.Fatalf("got error %v; want %v", err, ErrDuplicateEmail)
+		}
+
+		// Updating a user onto an email already in use fails the same way.
+		other := insertTestUser(t, models, "bob@example.com")
+		other.Email = "alice@example.com"
+
+		err = models.User.Update(other)
+		if !errors.Is(err, ErrDuplicateEmail) {
+			t.Fatalf("got error %v updating the email; want %v", err, ErrDuplicateEmail)
+		}
+	})
+}
+
+func TestUserForToken(t *testing.T) {
+	testStores(t, func(t *testing.T, models Models) {
+		user := insertTestUser(t, models, "alice@example.com")
+
+		valid, err := models.Tokens.New(user.ID, time.Hour, ScopeAuthentication)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expired, err := models.Tokens.New(user.ID, -time.Hour, ScopeAuthentication)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name      string
+			scope     string
+			plaintext string
+			wantErr   error
+		}{
+			{"Valid", ScopeAuthentication, valid.Plaintext, nil},
+			{"Other scope", ScopeActivation, valid.Plaintext, ErrRecordNotFound},
+			{"Expired", ScopeAuthentication, expired.Plaintext, ErrRecordNotFound},
+			{"Unknown", ScopeAuthentication, "ABCDEFGHIJKLMNOPQRSTUVWXYZ", ErrRecordNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				found, err := models.User.GetForToken(tt.scope, tt.plaintext)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v; want %v", err, tt.wantErr)
+				}
+
+				if err == nil && found.ID != user.ID {
+					t.Errorf("got user %d; want %d", found.ID, user.ID)
+				}
+			})
+		}
+
+		// Deleting the authentication tokens of a user signs them out.
+		err = models.Tokens.DeleteAllForUser(ScopeAuthentication, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = models.User.GetForToken(ScopeAuthentication, valid.Plaintext)
+		if !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("got error %v for a deleted token; want %v", err, ErrRecordNotFound)
+		}
+	})
+}
+
+func TestMovieFilter(t *testing.T) {
+	testStores(t, func(t *testing.T, models Models) {
+		godfather := insertTestMovie(t, models, "The Godfather", 1972, "crime", "drama")
+		heat := insertTestMovie(t, models, "Heat", 1995, "crime", "thriller")
+		moana := insertTestMovie(t, models, "Moana", 2016, "animation", "adventure")
+
+		moana.OriginalLanguage = "en"
+		moana.Titles = MovieTitles{"fr": "Vaiana, la légende du bout du monde"}
+		err := models.Movies.Update(moana)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name   string
+			filter MovieFilter
+			want   []int64
+		}{
+			{"Everything", MovieFilter{}, []int64{godfather.ID, heat.ID, moana.ID}},
+			{"Every genre", MovieFilter{Genres: []string{"crime", "drama"}}, []int64{godfather.ID}},
+			{"One genre", MovieFilter{Genres: []string{"crime"}}, []int64{godfather.ID, heat.ID}},
+			{"Any genre", MovieFilter{GenresAny: []string{"drama", "animation"}}, []int64{godfather.ID, moana.ID}},
+			{"Unknown genre", MovieFilter{Genres: []string{"western"}}, []int64{}},
+			{"Title word", MovieFilter{Title: "godfather"}, []int64{godfather.ID}},
+			{"Title words", MovieFilter{Title: "the GODFATHER"}, []int64{godfather.ID}},
+			{"Part of a word", MovieFilter{Title: "god"}, []int64{}},
+			{"Translated title", MovieFilter{Title: "vaiana"}, []int64{moana.ID}},
+			{"Title and genre", MovieFilter{Title: "heat", Genres: []string{"drama"}}, []int64{}},
+			{"Years", MovieFilter{YearMin: 1990, YearMax: 2000}, []int64{heat.ID}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				movies, metadata, err := models.Movies.GetAll(tt.filter, testFilters)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if got := movieIDs(movies); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got movies %v; want %v", got, tt.want)
+				}
+
+				if metadata.TotalRecords != len(tt.want) {
+					t.Errorf("got %d total records; want %d", metadata.TotalRecords, len(tt.want))
+				}
+			})
+		}
+	})
+}
+
+func TestMovieFindDuplicates(t *testing.T) {
+	testStores(t, func(t *testing.T, models Models) {
+		moana := insertTestMovie(t, models, "Moana", 2016, "animation")
+		insertTestMovie(t, models, "Moana", 2017, "animation")
+
+		trashed := insertTestMovie(t, models, "Moana", 2016, "animation")
+		err := models.Movies.Delete(trashed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var duplicates []*Movie
+
+		// FindDuplicates locks the title and year until the end of the transaction it runs in.
+		err = models.Atomic(func(tx Models) error {
+			var err error
+			duplicates, err = tx.Movies.FindDuplicates("The Moana!", 2016)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := movieIDs(duplicates), []int64{moana.ID}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got duplicates %v; want %v", got, want)
+		}
+	})
+}
+
+// errRollback is returned by the functions given to Atomic() to have their changes rolled back.
+var errRollback = errors.New("roll back")
+
+func TestAtomicRollback(t *testing.T) {
+	testStores(t, func(t *testing.T, models Models) {
+		moana := insertTestMovie(t, models, "Moana", 2016, "animation")
+
+		// change inserts a movie and updates the first one, then gives up one way or another.
+		change := func(giveUp func() error) func(tx Models) error {
+			return func(tx Models) error {
+				insertTestMovie(t, tx, "Up", 2009, "animation")
+
+				movie, err := tx.Movies.Get(moana.ID)
+				if err != nil {
+					return err
+				}
+
+				movie.Title = "Vaiana"
+				err = tx.Movies.Update(movie)
+				if err != nil {
+					return err
+				}
+
+				return giveUp()
+			}
+		}
+
+		tests := []struct {
+			name   string
+			giveUp func() error
+		}{
+			{"Error", func() error { return errRollback }},
+			{"Panic", func() error { panic(errRollback) }},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err, recovered := atomicRecover(models, change(tt.giveUp))
+				if err != errRollback && recovered != errRollback {
+					t.Fatalf("got error %v and panic %v; want %v", err, recovered, errRollback)
+				}
+
+				movies, _, err := models.Movies.GetAll(MovieFilter{}, testFilters)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(movies) != 1 || movies[0].Title != "Moana" || movies[0].Version != 1 {
+					t.Errorf("got movies %+v after the rollback; want Moana alone and unchanged", movies)
+				}
+			})
+		}
+
+		// The models are usable once a transaction has panicked.
+		err := models.Atomic(func(tx Models) error {
+			insertTestMovie(t, tx, "Up", 2009, "animation")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		movies, _, err := models.Movies.GetAll(MovieFilter{}, testFilters)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(movies) != 2 {
+			t.Errorf("got %d movies after the commit; want 2", len(movies))
+		}
+	})
+}
+
+// atomicRecover runs fn with Atomic() and returns its error, or what it panicked with.
+func atomicRecover(models Models, fn func(tx Models) error) (err error, recovered interface{}) {
+	defer func() {
+		recovered = recover()
+	}()
+
+	return models.Atomic(fn), nil
+}
@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Suggestion is a title completion offered while a search is being typed.
+type Suggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// escapeLike escapes the characters which are special in a LIKE pattern, so that s matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// suggestedTitle picks the title a suggestion shows: the original title if it matches the prefix, or else the first
+// translated title, by language tag, which does. It also reports whether that title begins with the prefix.
+func suggestedTitle(title string, titles MovieTitles, prefix string) (string, bool) {
+	lowered := strings.ToLower(prefix)
+
+	candidates := []string{title}
+	for _, tag := range titles.languages() {
+		candidates = append(candidates, titles[tag])
+	}
+
+	for _, candidate := range candidates {
+		if strings.HasPrefix(strings.ToLower(candidate), lowered) {
+			return candidate, true
+		}
+	}
+
+	for _, candidate := range candidates {
+		if matchesWordPrefixes(candidate, prefix) {
+			return candidate, false
+		}
+	}
+
+	return title, false
+}
+
+// Suggest returns up to limit movies with a title, original or translated, which begins with the prefix or has words
+// beginning with each of its words, so "godf" completes to "The Godfather" and "parr" to "Le Parrain". Titles beginning
+// with the prefix come first, then the most rated movies. Each suggestion shows the title which matched. The
+// whole-title match on the original title is served by the movies_title_prefix_idx index, and the word matches by the
+// movies_search_titles_idx index, which also covers a translated title beginning with the prefix.
+func (m MovieModel) Suggest(prefix string, limit int) ([]*Suggestion, error) {
+	query := `
+		SELECT id, title, titles, year
+		FROM movies
+		WHERE deleted_at IS NULL
+		AND (lower(title) LIKE $1 OR to_tsvector('simple', movie_search_titles(title, titles)) @@ to_tsquery('simple', $2))
+		ORDER BY (
+			lower(title) LIKE $1 OR EXISTS (SELECT 1 FROM jsonb_each_text(titles) AS t WHERE lower(t.value) LIKE $1)
+		) DESC, rating_count DESC, title ASC, id ASC
+		LIMIT $3`
+
+	args := []interface{}{escapeLike(strings.ToLower(prefix)) + "%", prefixQuery(prefix), limit}
+
+	// Suggestions are requested on every keystroke, so give up quickly rather than let them queue up.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+
+	for rows.Next() {
+		var suggestion Suggestion
+		var titles MovieTitles
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &titles, &suggestion.Year)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestion.Title, _ = suggestedTitle(suggestion.Title, titles, prefix)
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
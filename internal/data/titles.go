@@ -0,0 +1,177 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lorezi/duxfilm/internal/validator"
+	"golang.org/x/text/language"
+)
+
+// MovieTitles holds the translated titles of a movie by BCP 47 language tag, e.g. "fr" or "pt-BR". It is stored in
+// the titles column of the movies table as a JSON object.
+type MovieTitles map[string]string
+
+func (mt MovieTitles) Value() (driver.Value, error) {
+	if mt == nil {
+		return "{}", nil
+	}
+
+	// A string rather than []byte, which the driver would send as bytea.
+	js, err := json.Marshal(mt)
+	return string(js), err
+}
+
+func (mt *MovieTitles) Scan(src interface{}) error {
+	var js []byte
+
+	switch src := src.(type) {
+	case []byte:
+		js = src
+	case string:
+		js = []byte(src)
+	case nil:
+		*mt = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into MovieTitles", src)
+	}
+
+	titles := MovieTitles{}
+	err := json.Unmarshal(js, &titles)
+	if err != nil {
+		return err
+	}
+
+	*mt = titles
+	return nil
+}
+
+// languages returns the tags of the translations in order.
+func (mt MovieTitles) languages() []string {
+	tags := make([]string, 0, len(mt))
+	for tag := range mt {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// copyTitles returns a copy of the translations which doesn't share the map with the original.
+func copyTitles(titles MovieTitles) MovieTitles {
+	if titles == nil {
+		return nil
+	}
+
+	c := make(MovieTitles, len(titles))
+	for tag, title := range titles {
+		c[tag] = title
+	}
+	return c
+}
+
+// equalTitles reports whether two sets of translations are the same. No translations at all equal an empty set.
+func equalTitles(a, b MovieTitles) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for tag, title := range a {
+		if other, ok := b[tag]; !ok || other != title {
+			return false
+		}
+	}
+	return true
+}
+
+// SetLanguages chooses the languages, most preferred first, the title of the movie is written in when it is encoded
+// as JSON.
+func (m *Movie) SetLanguages(languages []language.Tag) {
+	m.languages = languages
+}
+
+// LocalizedTitle returns the title of the movie in the language which best matches the chosen languages. The original
+// title is returned when none of them match a translation, or when the original language matches best.
+func (m *Movie) LocalizedTitle() string {
+	if len(m.languages) == 0 || len(m.Titles) == 0 {
+		return m.Title
+	}
+
+	// The original title comes first, so that it is the default. Its language is undetermined if it isn't known.
+	original := language.Und
+	if m.OriginalLanguage != "" {
+		original = language.Make(m.OriginalLanguage)
+	}
+
+	tags := m.Titles.languages()
+
+	supported := []language.Tag{original}
+	for _, tag := range tags {
+		supported = append(supported, language.Make(tag))
+	}
+
+	_, i, confidence := language.NewMatcher(supported).Match(m.languages...)
+	if confidence == language.No || i == 0 {
+		return m.Title
+	}
+
+	return m.Titles[tags[i-1]]
+}
+
+// movieSearchTitles joins the original title and its translations into the text the title search runs against. It
+// agrees with the movie_search_titles() SQL function.
+func movieSearchTitles(movie *Movie) string {
+	text := movie.Title
+	for _, tag := range movie.Titles.languages() {
+		text += " " + movie.Titles[tag]
+	}
+	return text
+}
+
+// ParseLanguage reads a BCP 47 language tag and returns it in canonical form, e.g. "pt-BR" for "pt-br".
+func ParseLanguage(s string) (string, error) {
+	tag, err := language.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	return tag.String(), nil
+}
+
+// validateTitles checks the original language and translated titles of a movie, and rewrites their language tags in
+// canonical form, so that the same language is always stored under the same tag.
+func validateTitles(v *validator.Validator, movie *Movie) {
+	if movie.OriginalLanguage != "" {
+		tag, err := ParseLanguage(movie.OriginalLanguage)
+		if v.Check(err == nil, "original_language", "must be a BCP 47 language tag"); err == nil {
+			movie.OriginalLanguage = tag
+		}
+	}
+
+	v.Check(len(movie.Titles) <= 50, "titles", "must not contain more than 50 translations")
+
+	titles := make(MovieTitles, len(movie.Titles))
+	for _, key := range movie.Titles.languages() {
+		title := movie.Titles[key]
+
+		tag, err := ParseLanguage(key)
+		if err != nil {
+			v.AddError("titles", fmt.Sprintf("%q must be a BCP 47 language tag", key))
+			continue
+		}
+
+		v.Check(title != "", "titles", fmt.Sprintf("%q must be provided", key))
+		v.Check(len(title) <= 500, "titles", fmt.Sprintf("%q must not be more than 500 bytes long", key))
+		v.Check(tag != movie.OriginalLanguage, "titles", fmt.Sprintf("%q must not be the original language", key))
+
+		if _, ok := titles[tag]; ok {
+			v.AddError("titles", fmt.Sprintf("%q must not repeat another language", key))
+		}
+		titles[tag] = title
+	}
+
+	if movie.Titles != nil {
+		movie.Titles = titles
+	}
+}
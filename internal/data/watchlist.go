@@ -0,0 +1,301 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateWatchlistItem = errors.New("movie is already on the watchlist")
+
+type WatchlistModel struct {
+	DB DBTX
+}
+
+// WatchlistItem is a movie saved on a user's watchlist. Position orders the watchlist manually, starting at 1, and
+// WatchedOn is set once the user has marked the movie as watched. Movie is filled in when items are read back.
+type WatchlistItem struct {
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"-"`
+	Position  int32     `json:"position"`
+	WatchedOn *Date     `json:"watched_on,omitempty"`
+	AddedAt   time.Time `json:"added_at"`
+	Movie     *Movie    `json:"movie,omitempty"`
+}
+
+// lockWatchlist locks the user's row until the end of the transaction, so that changes to the positions on their
+// watchlist are made one at a time.
+func (m WatchlistModel) lockWatchlist(ctx context.Context, userID int64) error {
+	var id int64
+
+	err := m.DB.QueryRowContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// clampPosition returns the position to use for an item, given the last position it can take. Zero or a position
+// past the end places the item last. Positions are not renumbered when a purged movie takes its items with it, so the
+// last position is found with max() rather than count().
+func clampPosition(position, last int32) int32 {
+	if position < 1 || position > last {
+		return last
+	}
+	return position
+}
+
+// Add puts a movie on a user's watchlist at the item's position, moving later items down, or at the end if the
+// position is zero. It returns ErrRecordNotFound if the movie doesn't exist or is in the trash, and
+// ErrDuplicateWatchlistItem if it is already on the watchlist. It must be called inside Models.Atomic().
+func (m WatchlistModel) Add(item *WatchlistItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.lockWatchlist(ctx, item.UserID)
+	if err != nil {
+		return err
+	}
+
+	var live, exists bool
+	var last int32
+
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM movies WHERE id = $2 AND deleted_at IS NULL),
+			EXISTS (SELECT 1 FROM watchlist_items WHERE user_id = $1 AND movie_id = $2),
+			(SELECT coalesce(max(position), 0) FROM watchlist_items WHERE user_id = $1)`
+
+	err = m.DB.QueryRowContext(ctx, query, item.UserID, item.MovieID).Scan(&live, &exists, &last)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case !live:
+		return ErrRecordNotFound
+	case exists:
+		return ErrDuplicateWatchlistItem
+	}
+
+	item.Position = clampPosition(item.Position, last+1)
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE watchlist_items
+		SET position = position + 1
+		WHERE user_id = $1 AND position >= $2`, item.UserID, item.Position)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO watchlist_items (user_id, movie_id, position, watched_on)
+		VALUES ($1, $2, $3, $4)
+		RETURNING added_at`
+
+	args := []interface{}{item.UserID, item.MovieID, item.Position, item.WatchedOn}
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&item.AddedAt)
+}
+
+// Update moves an item to its position, shifting the items in between, and saves its WatchedOn date. It must be
+// called inside Models.Atomic().
+func (m WatchlistModel) Update(item *WatchlistItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.lockWatchlist(ctx, item.UserID)
+	if err != nil {
+		return err
+	}
+
+	var current, last int32
+
+	query := `
+		SELECT position, (SELECT max(position) FROM watchlist_items WHERE user_id = $1)
+		FROM watchlist_items
+		WHERE user_id = $1 AND movie_id = $2`
+
+	err = m.DB.QueryRowContext(ctx, query, item.UserID, item.MovieID).Scan(&current, &last)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	item.Position = clampPosition(item.Position, last)
+
+	if item.Position < current {
+		_, err = m.DB.ExecContext(ctx, `
+			UPDATE watchlist_items
+			SET position = position + 1
+			WHERE user_id = $1 AND position >= $2 AND position < $3`, item.UserID, item.Position, current)
+	} else if item.Position > current {
+		_, err = m.DB.ExecContext(ctx, `
+			UPDATE watchlist_items
+			SET position = position - 1
+			WHERE user_id = $1 AND position > $2 AND position <= $3`, item.UserID, current, item.Position)
+	}
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE watchlist_items
+		SET position = $3, watched_on = $4
+		WHERE user_id = $1 AND movie_id = $2`
+
+	_, err = m.DB.ExecContext(ctx, query, item.UserID, item.MovieID, item.Position, item.WatchedOn)
+	return err
+}
+
+// Remove takes a movie off a user's watchlist, moving later items up. It must be called inside Models.Atomic().
+func (m WatchlistModel) Remove(userID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.lockWatchlist(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var position int32
+
+	query := `
+		DELETE FROM watchlist_items
+		WHERE user_id = $1 AND movie_id = $2
+		RETURNING position`
+
+	err = m.DB.QueryRowContext(ctx, query, userID, movieID).Scan(&position)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `
+		UPDATE watchlist_items
+		SET position = position - 1
+		WHERE user_id = $1 AND position > $2`, userID, position)
+	return err
+}
+
+// watchlistColumns lists the columns scanned by scanWatchlistItem().
+const watchlistColumns = `
+	watchlist_items.movie_id, watchlist_items.user_id, watchlist_items.position, watchlist_items.watched_on,
+	watchlist_items.added_at, movies.id, movies.created_at, movies.title, movies.original_language, movies.titles,
+	movies.year, movies.duration, movies.genres, movies.version, movies.rating_average, movies.rating_count,
+	movies.images`
+
+// Get returns an item of a user's watchlist. Items whose movie is in the trash are hidden.
+func (m WatchlistModel) Get(userID, movieID int64) (*WatchlistItem, error) {
+	query := `
+		SELECT ` + watchlistColumns + `
+		FROM watchlist_items
+		INNER JOIN movies ON movies.id = watchlist_items.movie_id
+		WHERE watchlist_items.user_id = $1 AND watchlist_items.movie_id = $2 AND movies.deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	item, err := scanWatchlistItem(m.DB.QueryRowContext(ctx, query, userID, movieID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// GetAllForUser lists a user's watchlist. Items whose movie is in the trash are hidden until it is restored. A
+// non-nil watched selects only the items which have, or have not, been watched. The title and year sort columns
+// belong to the movie; the others belong to the item.
+func (m WatchlistModel) GetAllForUser(userID int64, watched *bool, filters Filters) ([]*WatchlistItem, Metadata, error) {
+	table := "watchlist_items"
+	if column := filters.sortColumn(); column == "title" || column == "year" {
+		table = "movies"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), `+watchlistColumns+`
+		FROM watchlist_items
+		INNER JOIN movies ON movies.id = watchlist_items.movie_id
+		WHERE watchlist_items.user_id = $1 AND movies.deleted_at IS NULL
+		AND ($2::boolean IS NULL OR (watchlist_items.watched_on IS NOT NULL) = $2)
+		ORDER BY %s.%s %s, watchlist_items.position ASC
+		LIMIT $3 OFFSET $4`, table, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, watched, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*WatchlistItem{}
+
+	for rows.Next() {
+		item, err := scanWatchlistItem(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return items, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// scanWatchlistItem scans the watchlistColumns of a row. Any extra columns selected before them are scanned into
+// leading.
+func scanWatchlistItem(row interface{ Scan(...interface{}) error }, leading ...interface{}) (*WatchlistItem, error) {
+	var item WatchlistItem
+	var movie Movie
+
+	dest := append(leading,
+		&item.MovieID,
+		&item.UserID,
+		&item.Position,
+		&item.WatchedOn,
+		&item.AddedAt,
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.OriginalLanguage,
+		&movie.Titles,
+		&movie.Year,
+		&movie.Duration,
+		pq.Array(&movie.Genres),
+		&movie.Version,
+		&movie.RatingAverage,
+		&movie.RatingCount,
+		&movie.Images,
+	)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Movie = &movie
+
+	return &item, nil
+}
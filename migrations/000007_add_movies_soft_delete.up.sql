@@ -0,0 +1,11 @@
+ALTER TABLE
+  movies
+ADD
+  COLUMN IF NOT EXISTS deleted_at TIMESTAMP(0) with time zone;
+CREATE INDEX IF NOT EXISTS movies_deleted_at_idx ON movies (deleted_at)
+WHERE
+  deleted_at IS NOT NULL;
+INSERT INTO
+  permissions (code)
+VALUES
+  ('movies:purge');
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS people (
+  id bigserial PRIMARY KEY,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  name text NOT NULL,
+  birth_year integer,
+  aliases text [] NOT NULL DEFAULT '{}',
+  version integer NOT NULL DEFAULT 1
+);
+CREATE TABLE IF NOT EXISTS credits (
+  id bigserial PRIMARY KEY,
+  movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+  person_id BIGINT NOT NULL REFERENCES people ON DELETE CASCADE,
+  role text NOT NULL,
+  character text NOT NULL DEFAULT '',
+  billing_order integer NOT NULL
+);
+ALTER TABLE
+  credits
+ADD
+  CONSTRAINT credits_role_check CHECK (
+    role IN ('director', 'writer', 'actor', 'composer')
+  );
+CREATE INDEX IF NOT EXISTS people_name_idx ON people (lower(name));
+CREATE INDEX IF NOT EXISTS credits_movie_id_idx ON credits (movie_id, billing_order);
+CREATE INDEX IF NOT EXISTS credits_person_id_idx ON credits (person_id, role);
@@ -0,0 +1,4 @@
+ALTER TABLE
+  movies DROP COLUMN IF EXISTS rating_average,
+  DROP COLUMN IF EXISTS rating_count;
+DROP TABLE IF EXISTS ratings;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS ratings (
+  user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+  movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+  score smallint NOT NULL,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, movie_id)
+);
+ALTER TABLE
+  ratings
+ADD
+  CONSTRAINT ratings_score_check CHECK (
+    score BETWEEN 1
+    AND 10
+  );
+CREATE INDEX IF NOT EXISTS ratings_movie_id_idx ON ratings (movie_id);
+ALTER TABLE
+  movies
+ADD
+  COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0,
+ADD
+  COLUMN IF NOT EXISTS rating_average double precision NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS movies_rating_count_idx ON movies (rating_count, id);
+CREATE INDEX IF NOT EXISTS movies_rating_average_idx ON movies (rating_average, id);
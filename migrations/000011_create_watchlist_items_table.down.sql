@@ -0,0 +1,5 @@
+DELETE FROM
+  permissions
+WHERE
+  code = 'watchlist:use';
+DROP TABLE IF EXISTS watchlist_items;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS watchlist_items (
+  user_id BIGINT NOT NULL REFERENCES users ON DELETE CASCADE,
+  movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+  position integer NOT NULL,
+  watched_on date,
+  added_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, movie_id)
+);
+CREATE INDEX IF NOT EXISTS watchlist_items_position_idx ON watchlist_items (user_id, position);
+INSERT INTO
+  permissions (code)
+VALUES
+  ('watchlist:use');
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS movies_year_idx ON movies (year);
+CREATE INDEX IF NOT EXISTS movies_duration_idx ON movies (duration);
+CREATE INDEX IF NOT EXISTS movies_created_at_idx ON movies (created_at);
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS movies_title_prefix_idx ON movies (lower(title) text_pattern_ops)
+WHERE
+  deleted_at IS NULL;
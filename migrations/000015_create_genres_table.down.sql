@@ -0,0 +1,5 @@
+DELETE FROM
+  permissions
+WHERE
+  code = 'genres:write';
+DROP TABLE IF EXISTS genres;
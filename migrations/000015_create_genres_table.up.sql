@@ -0,0 +1,76 @@
+CREATE TABLE IF NOT EXISTS genres (
+  id bigserial PRIMARY KEY,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  slug text UNIQUE NOT NULL,
+  name text NOT NULL,
+  aliases text [] NOT NULL DEFAULT '{}',
+  version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS genres_aliases_idx ON genres USING GIN (aliases);
+INSERT INTO
+  genres (slug, name, aliases)
+VALUES
+  ('action', 'Action', '{}'),
+  ('adventure', 'Adventure', '{}'),
+  ('animation', 'Animation', '{animated,cartoon}'),
+  ('comedy', 'Comedy', '{}'),
+  ('crime', 'Crime', '{}'),
+  ('documentary', 'Documentary', '{}'),
+  ('drama', 'Drama', '{}'),
+  ('family', 'Family', '{}'),
+  ('fantasy', 'Fantasy', '{}'),
+  ('history', 'History', '{historical}'),
+  ('horror', 'Horror', '{}'),
+  ('music', 'Music', '{musical}'),
+  ('mystery', 'Mystery', '{}'),
+  ('romance', 'Romance', '{romantic}'),
+  ('sci-fi', 'Science Fiction', '{science-fiction,scifi,sf}'),
+  ('thriller', 'Thriller', '{}'),
+  ('war', 'War', '{}'),
+  ('western', 'Western', '{}') ON CONFLICT DO NOTHING;
+-- Convert the free-form genres of existing movies to slugs, mapping aliases onto their genre and dropping the
+-- duplicates this creates, then add a genre for every slug which isn't in the taxonomy yet.
+UPDATE
+  movies
+SET
+  genres = ARRAY(
+    SELECT
+      canonical.slug
+    FROM
+      (
+        SELECT
+          coalesce(genre.slug, input.slug) AS slug,
+          min(input.ord) AS ord
+        FROM
+          (
+            SELECT
+              trim(
+                BOTH '-'
+                FROM
+                  regexp_replace(lower(g), '[^a-z0-9]+', '-', 'g')
+              ) AS slug,
+              ord
+            FROM
+              unnest(movies.genres) WITH ORDINALITY AS u (g, ord)
+          ) AS input
+          LEFT JOIN genres AS genre ON input.slug = ANY(genre.aliases)
+        WHERE
+          input.slug <> ''
+        GROUP BY
+          1
+      ) AS canonical
+    ORDER BY
+      canonical.ord
+  );
+INSERT INTO
+  genres (slug, name)
+SELECT
+  DISTINCT g,
+  initcap(replace(g, '-', ' '))
+FROM
+  movies,
+  unnest(movies.genres) AS g ON CONFLICT DO NOTHING;
+INSERT INTO
+  permissions (code)
+VALUES
+  ('genres:write');
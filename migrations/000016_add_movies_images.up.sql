@@ -0,0 +1,4 @@
+ALTER TABLE
+  movies
+ADD
+  COLUMN IF NOT EXISTS images jsonb NOT NULL DEFAULT '{}';
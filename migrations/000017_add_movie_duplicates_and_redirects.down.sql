@@ -0,0 +1,5 @@
+ALTER TABLE
+  movie_revisions DROP COLUMN IF EXISTS merged_from;
+DROP TABLE IF EXISTS movie_redirects;
+DROP INDEX IF EXISTS movies_title_key_idx;
+DROP FUNCTION IF EXISTS movie_title_key(text);
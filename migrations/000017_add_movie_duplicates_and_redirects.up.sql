@@ -0,0 +1,25 @@
+-- movie_title_key normalises a title for spotting duplicates: lower case, runs of punctuation and spaces collapsed
+-- into one space and a leading article dropped. It must agree with NormalizeTitle() in internal/data.
+CREATE
+OR REPLACE FUNCTION movie_title_key(title text) RETURNS text LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+SELECT
+  regexp_replace(
+    trim(
+      regexp_replace(lower(title), '[^[:alnum:]]+', ' ', 'g')
+    ),
+    '^(the|a|an) ',
+    ''
+  ) $$;
+CREATE INDEX IF NOT EXISTS movies_title_key_idx ON movies (year, movie_title_key(title))
+WHERE
+  deleted_at IS NULL;
+CREATE TABLE IF NOT EXISTS movie_redirects (
+  source_id BIGINT PRIMARY KEY,
+  target_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS movie_redirects_target_id_idx ON movie_redirects (target_id);
+ALTER TABLE
+  movie_revisions
+ADD
+  COLUMN IF NOT EXISTS merged_from BIGINT;
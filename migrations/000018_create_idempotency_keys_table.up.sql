@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  user_id BIGINT NOT NULL,
+  key TEXT NOT NULL,
+  fingerprint bytea NOT NULL,
+  status INTEGER,
+  headers jsonb,
+  body bytea,
+  expires_at TIMESTAMP(0) WITH time zone NOT NULL,
+  PRIMARY KEY (user_id, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
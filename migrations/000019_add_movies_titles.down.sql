@@ -0,0 +1,8 @@
+CREATE INDEX IF NOT EXISTS movies_title_idx ON movies USING GIN (to_tsvector('simple', title));
+CREATE INDEX IF NOT EXISTS movies_title_trgm_idx ON movies USING GIN (title gin_trgm_ops);
+DROP INDEX IF EXISTS movies_search_titles_trgm_idx;
+DROP INDEX IF EXISTS movies_search_titles_idx;
+DROP FUNCTION IF EXISTS movie_search_titles(text, jsonb);
+ALTER TABLE
+  movies DROP COLUMN IF EXISTS titles,
+  DROP COLUMN IF EXISTS original_language;
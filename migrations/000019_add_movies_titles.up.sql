@@ -0,0 +1,29 @@
+ALTER TABLE
+  movies
+ADD
+  COLUMN IF NOT EXISTS original_language text NOT NULL DEFAULT '',
+ADD
+  COLUMN IF NOT EXISTS titles jsonb NOT NULL DEFAULT '{}';
+-- movie_search_titles joins a title and its translations, in order of language tag, into the text the title search
+-- runs against. It must agree with movieSearchTitles() in internal/data.
+CREATE
+OR REPLACE FUNCTION movie_search_titles(title text, titles jsonb) RETURNS text LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+SELECT
+  concat_ws(
+    ' ',
+    title,
+    (
+      SELECT
+        string_agg(value, ' ' ORDER BY key)
+      FROM
+        jsonb_each_text(titles)
+    )
+  ) $$;
+CREATE INDEX IF NOT EXISTS movies_search_titles_idx ON movies USING GIN (
+  to_tsvector('simple', movie_search_titles(title, titles))
+);
+CREATE INDEX IF NOT EXISTS movies_search_titles_trgm_idx ON movies USING GIN (
+  movie_search_titles(title, titles) gin_trgm_ops
+);
+DROP INDEX IF EXISTS movies_title_trgm_idx;
+DROP INDEX IF EXISTS movies_title_idx;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS collections (
+  id bigserial PRIMARY KEY,
+  created_at TIMESTAMP(0) with time zone NOT NULL DEFAULT NOW(),
+  name text NOT NULL,
+  description text NOT NULL DEFAULT '',
+  version integer NOT NULL DEFAULT 1
+);
+CREATE TABLE IF NOT EXISTS collection_movies (
+  collection_id BIGINT NOT NULL REFERENCES collections ON DELETE CASCADE,
+  movie_id BIGINT NOT NULL REFERENCES movies ON DELETE CASCADE,
+  position integer NOT NULL,
+  PRIMARY KEY (collection_id, movie_id)
+);
+CREATE INDEX IF NOT EXISTS collections_name_idx ON collections (lower(name));
+CREATE INDEX IF NOT EXISTS collection_movies_position_idx ON collection_movies (collection_id, position);
+CREATE INDEX IF NOT EXISTS collection_movies_movie_id_idx ON collection_movies (movie_id);
+INSERT INTO
+  permissions (code)
+VALUES
+  ('collections:write');